@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	alfredxml "github.com/lemmi/gnw/alfredxml"
+)
+
+// reports from other nodes are dropped if they are not refreshed within this
+// duration
+const aggregateMaxAge = 15 * time.Minute
+
+// drop files modified more recently are skipped, they may still be written
+const dropDirSettle = 5 * time.Second
+
+// maximum size of a report accepted via http, both compressed and decoded
+const aggregateMaxBody = 1 << 20
+
+type aggregated struct {
+	data     alfredxml.Data
+	received time.Time
+	// signed by one of the forwarder keys, drop files are not
+	verified bool
+}
+
+// aggregator collects reports from other nodes, that are forwarded together
+// with the own report. A nil *aggregator is valid and collects nothing.
+type aggregator struct {
+	c    Config
+	keys []ed25519.PublicKey
+
+	mu      sync.Mutex
+	reports map[string]aggregated
+}
+
+func newAggregator(c Config) (*aggregator, error) {
+	keys, err := forwarderKeys(c)
+	if err != nil {
+		return nil, err
+	}
+	return &aggregator{
+		c:       c,
+		keys:    keys,
+		reports: map[string]aggregated{},
+	}, nil
+}
+
+// forwarderKeys parses the comma separated ForwarderKeys option
+func forwarderKeys(c Config) ([]ed25519.PublicKey, error) {
+	var keys []ed25519.PublicKey
+	for _, k := range strings.Split(c.ForwarderKeys, ",") {
+		if k = strings.TrimSpace(k); k == "" {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(k)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("forwarder key %q is not a base64 encoded ed25519 public key", k)
+		}
+		keys = append(keys, ed25519.PublicKey(key))
+	}
+	return keys, nil
+}
+
+// trusted reports whether key is one of the forwarder keys
+func (a *aggregator) trusted(key ed25519.PublicKey) bool {
+	for _, k := range a.keys {
+		if k.Equal(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *aggregator) add(reports alfredxml.Alfred2, verified bool) {
+	now := time.Now()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for mac, d := range reports {
+		// Alfred2Slice uses the first interface to key the report
+		if len(d.InterfaceData.Interfaces) == 0 {
+			a.c.Log.Warn("Ignoring report without interfaces", "node", mac)
+			continue
+		}
+		a.reports[mac] = aggregated{data: d, received: now, verified: verified}
+	}
+}
+
+// collect reads pending drop files and returns all current reports. verified
+// is false if any of them was not signed by a forwarder key, such batches must
+// not be signed with the own key.
+func (a *aggregator) collect() (ds []alfredxml.Data, verified bool) {
+	if a == nil {
+		return nil, true
+	}
+
+	if err := a.readDropDir(); err != nil {
+		a.c.Log.Error("Reading drop directory failed", "err", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	verified = true
+	var macs []string
+	for mac, r := range a.reports {
+		if time.Since(r.received) > aggregateMaxAge {
+			delete(a.reports, mac)
+			continue
+		}
+		macs = append(macs, mac)
+		verified = verified && r.verified
+	}
+	sort.Strings(macs)
+
+	ds = make([]alfredxml.Data, 0, len(macs))
+	for _, mac := range macs {
+		ds = append(ds, a.reports[mac].data)
+	}
+	return ds, verified
+}
+
+// forget removes all reports received before t, usually after they have been
+// sent successfully
+func (a *aggregator) forget(t time.Time) {
+	if a == nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for mac, r := range a.reports {
+		if r.received.Before(t) {
+			delete(a.reports, mac)
+		}
+	}
+}
+
+func decodeAlfred2(r io.Reader) (alfredxml.Alfred2, error) {
+	ret := alfredxml.Alfred2{}
+	dec := json.NewDecoder(r)
+	for {
+		var a alfredxml.Alfred2
+		if err := dec.Decode(&a); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		for mac, d := range a {
+			ret[mac] = d
+		}
+	}
+	return ret, nil
+}
+
+// readDropDir loads and removes all *.json files in the drop directory. Writers
+// must create a report under another name, e.g. report.json.tmp, and rename
+// it to *.json once it is complete. Files modified within dropDirSettle are
+// left for the next crawl in case a writer doesn't.
+//
+// Drop files are not authenticated, anyone who can write to the directory can
+// inject reports. Batches containing them are sent unsigned.
+func (a *aggregator) readDropDir() error {
+	if a.c.DropDir == "" {
+		return nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(a.c.DropDir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			a.c.Log.Error("Reading report failed", "file", file, "err", err)
+			continue
+		}
+		if time.Since(info.ModTime()) < dropDirSettle {
+			continue
+		}
+
+		b, err := os.ReadFile(file)
+		if err != nil {
+			a.c.Log.Error("Reading report failed", "file", file, "err", err)
+			continue
+		}
+		if err := os.Remove(file); err != nil {
+			a.c.Log.Error("Removing report failed", "file", file, "err", err)
+		}
+
+		reports, err := decodeAlfred2(bytes.NewReader(b))
+		if err != nil {
+			a.c.Log.Warn("Invalid report", "file", file, "err", err)
+			continue
+		}
+		a.add(reports, false)
+	}
+
+	return nil
+}
+
+// ServeHTTP accepts reports in the same format as the alfred2 endpoint. The
+// request must be signed by one of the forwarder keys.
+func (a *aggregator) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	req.Body = http.MaxBytesReader(w, req.Body, aggregateMaxBody)
+	payload, err := alfredxml.ReadBody(req, aggregateMaxBody)
+	var maxBytesErr *http.MaxBytesError
+	if err == alfredxml.ErrBodyTooLarge || stderrors.As(err, &maxBytesErr) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// only accept reports signed by a forwarder key, see alfredxml.Sign
+	key, err := alfredxml.VerifyHeader(req.Header, payload)
+	if err == alfredxml.ErrNotSigned {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if !a.trusted(key) {
+		http.Error(w, "unknown forwarder key", http.StatusForbidden)
+		return
+	}
+
+	reports, err := decodeAlfred2(bytes.NewReader(payload))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	a.add(reports, true)
+	fmt.Fprintln(w, "ok")
+}
+
+func (a *aggregator) listen() error {
+	mux := http.NewServeMux()
+	mux.Handle("/api/alfred2", a)
+
+	srv := &http.Server{
+		Addr:              a.c.Listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       time.Minute,
+	}
+	return srv.ListenAndServe()
+}
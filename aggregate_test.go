@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lemmi/gnw/alfredxml"
+)
+
+func testConfig() Config {
+	return Config{Log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+}
+
+func testAggregator(t *testing.T, c Config) *aggregator {
+	t.Helper()
+	a, err := newAggregator(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestAggregatorDecompressionBomb(t *testing.T) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(make([]byte, 16*aggregateMaxBody)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() >= aggregateMaxBody {
+		t.Fatalf("compressed bomb is %d bytes, not below the limit", buf.Len())
+	}
+
+	req := httptest.NewRequest("POST", "/api/alfred2", &buf)
+	req.Header.Set("Content-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	testAggregator(t, testConfig()).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestAggregatorCompressedTooLarge(t *testing.T) {
+	// random data doesn't compress, so the compressed body exceeds the limit
+	// before the decoded one does
+	data := make([]byte, aggregateMaxBody+aggregateMaxBody/2)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("POST", "/api/alfred2", &buf)
+	req.Header.Set("Content-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	testAggregator(t, testConfig()).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+const dropReport = `{"02:00:00:00:00:01":"<data><interface_data><eth0><name>eth0</name><mac_addr>02:00:00:00:00:01</mac_addr></eth0></interface_data></data>"}`
+
+func TestReadDropDir(t *testing.T) {
+	dir := t.TempDir()
+	c := testConfig()
+	c.DropDir = dir
+	a := testAggregator(t, c)
+
+	settled := filepath.Join(dir, "settled.json")
+	fresh := filepath.Join(dir, "fresh.json")
+	tmp := filepath.Join(dir, "tmp.json.tmp")
+	for _, file := range []string{settled, fresh, tmp} {
+		if err := os.WriteFile(file, []byte(dropReport), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-time.Minute)
+	if err := os.Chtimes(settled, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(tmp, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	ds, verified := a.collect()
+	if len(ds) != 1 {
+		t.Errorf("collected %d reports, want 1", len(ds))
+	}
+	if verified {
+		t.Error("drop files reported as verified")
+	}
+	if _, err := os.Stat(settled); !os.IsNotExist(err) {
+		t.Errorf("settled report not removed: %v", err)
+	}
+	for _, file := range []string{fresh, tmp} {
+		if _, err := os.Stat(file); err != nil {
+			t.Errorf("%s removed: %v", filepath.Base(file), err)
+		}
+	}
+}
+
+func TestAggregatorAuth(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := testConfig()
+	c.ForwarderKeys = base64.StdEncoding.EncodeToString(pub)
+	payload := []byte(dropReport)
+
+	tests := []struct {
+		name   string
+		sign   func(h http.Header)
+		status int
+	}{
+		{"unsigned", func(h http.Header) {}, http.StatusUnauthorized},
+		{"unknown key", func(h http.Header) {
+			signature, publicKey := alfredxml.Sign(otherKey, payload)
+			h.Set(alfredxml.SignatureHeader, signature)
+			h.Set(alfredxml.PublicKeyHeader, publicKey)
+		}, http.StatusForbidden},
+		{"invalid signature", func(h http.Header) {
+			signature, _ := alfredxml.Sign(otherKey, payload)
+			h.Set(alfredxml.SignatureHeader, signature)
+			h.Set(alfredxml.PublicKeyHeader, base64.StdEncoding.EncodeToString(pub))
+		}, http.StatusForbidden},
+		{"forwarder key", func(h http.Header) {
+			signature, publicKey := alfredxml.Sign(key, payload)
+			h.Set(alfredxml.SignatureHeader, signature)
+			h.Set(alfredxml.PublicKeyHeader, publicKey)
+		}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		a := testAggregator(t, c)
+		req := httptest.NewRequest("POST", "/api/alfred2", bytes.NewReader(payload))
+		tt.sign(req.Header)
+		rec := httptest.NewRecorder()
+		a.ServeHTTP(rec, req)
+
+		if rec.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, rec.Code, tt.status)
+		}
+		ds, verified := a.collect()
+		if accepted := len(ds) > 0; accepted != (tt.status == http.StatusOK) {
+			t.Errorf("%s: collected %d reports", tt.name, len(ds))
+		}
+		if !verified {
+			t.Errorf("%s: signed reports not verified", tt.name)
+		}
+	}
+}
+
+func TestForwarderKeys(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := base64.StdEncoding.EncodeToString(pub)
+
+	c := testConfig()
+	c.ForwarderKeys = k + ", " + k + ","
+	keys, err := forwarderKeys(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || !keys[0].Equal(pub) {
+		t.Errorf("forwarderKeys() = %x", keys)
+	}
+
+	for _, v := range []string{"not base64!", base64.StdEncoding.EncodeToString(pub[:16])} {
+		c.ForwarderKeys = v
+		if _, err := forwarderKeys(c); err == nil {
+			t.Errorf("%q accepted", v)
+		}
+	}
+}
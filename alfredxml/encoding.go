@@ -0,0 +1,88 @@
+package alfredxml
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrBodyTooLarge is returned when a decoded body exceeds the limit
+var ErrBodyTooLarge = fmt.Errorf("decoded body too large")
+
+// DecodeBody wraps r to undo the given Content-Encoding. Supported encodings
+// are "gzip" and "zstd", an empty encoding or "identity" returns r unchanged.
+// Report signatures are computed over the decoded body.
+//
+// At most limit decoded bytes can be read, reading more fails with
+// ErrBodyTooLarge. Servers should always set a limit, as a small compressed
+// body can expand to an arbitrary size. A limit <= 0 disables the check.
+func DecodeBody(r io.Reader, contentEncoding string, limit int64) (io.ReadCloser, error) {
+	var body io.ReadCloser
+	switch contentEncoding {
+	case "", "identity":
+		body = io.NopCloser(r)
+	case "gzip":
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		body = gz
+	case "zstd":
+		// the window size is chosen by the sender, cap it at the 8 MiB
+		// every decoder is required to support
+		d, err := zstd.NewReader(r,
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxWindow(8<<20),
+		)
+		if err != nil {
+			return nil, err
+		}
+		body = d.IOReadCloser()
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", contentEncoding)
+	}
+
+	if limit <= 0 {
+		return body, nil
+	}
+	return &limitedBody{ReadCloser: body, remaining: limit}, nil
+}
+
+// limitedBody fails with ErrBodyTooLarge instead of silently truncating like
+// io.LimitReader
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, ErrBodyTooLarge
+	}
+	// read one byte past the limit to tell a body of exactly limit bytes
+	// from a larger one
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.ReadCloser.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n + int(l.remaining), ErrBodyTooLarge
+	}
+	return n, err
+}
+
+// ReadBody reads and decodes the body of a report request. The decoded body
+// is limited to limit bytes, see DecodeBody.
+func ReadBody(req *http.Request, limit int64) ([]byte, error) {
+	body, err := DecodeBody(req.Body, req.Header.Get("Content-Encoding"), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	return io.ReadAll(body)
+}
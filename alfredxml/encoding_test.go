@@ -0,0 +1,94 @@
+package alfredxml
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func gzipped(t *testing.T, b []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zstded(t *testing.T, b []byte) []byte {
+	w, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	return w.EncodeAll(b, nil)
+}
+
+func TestDecodeBodyLimit(t *testing.T) {
+	const limit = 1024
+	exact := bytes.Repeat([]byte("a"), limit)
+	bomb := make([]byte, 64*limit)
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		want     []byte
+		err      error
+	}{
+		{"identity", "", exact, exact, nil},
+		{"identity too large", "identity", append(exact, 'a'), nil, ErrBodyTooLarge},
+		{"gzip", "gzip", gzipped(t, exact), exact, nil},
+		{"gzip bomb", "gzip", gzipped(t, bomb), nil, ErrBodyTooLarge},
+		{"zstd", "zstd", zstded(t, exact), exact, nil},
+		{"zstd bomb", "zstd", zstded(t, bomb), nil, ErrBodyTooLarge},
+	}
+	for _, tt := range tests {
+		body, err := DecodeBody(bytes.NewReader(tt.body), tt.encoding, limit)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		got, err := io.ReadAll(body)
+		body.Close()
+		if err != tt.err {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.err)
+		}
+		if tt.err == nil && !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: decoded %d bytes, want %d", tt.name, len(got), len(tt.want))
+		}
+		if len(got) > limit {
+			t.Errorf("%s: read %d bytes past the limit", tt.name, len(got))
+		}
+	}
+}
+
+func TestDecodeBodyUnsupported(t *testing.T) {
+	if _, err := DecodeBody(bytes.NewReader(nil), "br", 0); err == nil {
+		t.Error("unsupported encoding accepted")
+	}
+}
+
+func TestReadBody(t *testing.T) {
+	payload := []byte(`{"64":{}}`)
+	req, err := http.NewRequest("POST", "/api/alfred2", bytes.NewReader(gzipped(t, payload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Encoding", "gzip")
+
+	got, err := ReadBody(req, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Errorf("ReadBody() = %q, want %q", got, payload)
+	}
+}
@@ -0,0 +1,69 @@
+package alfredxml
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+)
+
+// Header names used to transmit the signature of a report
+const (
+	SignatureHeader = "X-Gnw-Signature"
+	PublicKeyHeader = "X-Gnw-Public-Key"
+)
+
+// ErrNotSigned is returned by VerifyHeader for reports without a signature
+var ErrNotSigned = fmt.Errorf("report is not signed")
+
+// Sign signs the payload and returns the base64 encoded signature and public
+// key as they are sent in the SignatureHeader and PublicKeyHeader.
+//
+// A signature covers the whole payload of a request and authenticates the node
+// that sent it, not every report in it. A gateway forwarding the reports of
+// other nodes signs the whole batch with its own key. It only accepts reports
+// signed by an allowlisted key and does not pass these signatures on, so it
+// vouches for the reports it forwards. Batches containing reports that were
+// not verified, e.g. from a local drop directory, are sent unsigned.
+func Sign(key ed25519.PrivateKey, payload []byte) (signature, publicKey string) {
+	sig := ed25519.Sign(key, payload)
+	pub := key.Public().(ed25519.PublicKey)
+	return base64.StdEncoding.EncodeToString(sig), base64.StdEncoding.EncodeToString(pub)
+}
+
+// Verify checks the base64 encoded signature of payload against the base64
+// encoded public key and returns the decoded key on success. Servers should
+// additionally check that the key belongs to the sender of the request: the
+// node each report claims to be from, or a gateway trusted to forward reports
+// of other nodes, see Sign.
+func Verify(payload []byte, signature, publicKey string) (ed25519.PublicKey, error) {
+	pub, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	if len(pub) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key length %d", len(pub))
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	}
+
+	if !ed25519.Verify(pub, payload, sig) {
+		return nil, fmt.Errorf("signature mismatch")
+	}
+
+	return pub, nil
+}
+
+// VerifyHeader is like Verify, but takes the signature and public key from the
+// request header
+func VerifyHeader(h http.Header, payload []byte) (ed25519.PublicKey, error) {
+	signature := h.Get(SignatureHeader)
+	publicKey := h.Get(PublicKeyHeader)
+	if signature == "" || publicKey == "" {
+		return nil, ErrNotSigned
+	}
+	return Verify(payload, signature, publicKey)
+}
@@ -0,0 +1,79 @@
+package alfredxml
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"testing"
+)
+
+func TestSignVerify(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := []byte(`{"02:00:00:00:00:01":"<data/>"}`)
+
+	signature, publicKey := Sign(key, payload)
+	got, err := Verify(payload, signature, publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(pub) {
+		t.Errorf("Verify() returned %x, want %x", got, pub)
+	}
+
+	tampered := append([]byte(nil), payload...)
+	tampered[len(tampered)-3] = 'x'
+	shortKey := base64.StdEncoding.EncodeToString(pub[:16])
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name                 string
+		payload              []byte
+		signature, publicKey string
+	}{
+		{"tampered payload", tampered, signature, publicKey},
+		{"other key", payload, signature, base64.StdEncoding.EncodeToString(otherPub)},
+		{"wrong key length", payload, signature, shortKey},
+		{"bad key base64", payload, signature, "not base64!"},
+		{"bad signature base64", payload, "not base64!", publicKey},
+		{"truncated signature", payload, signature[:20], publicKey},
+	}
+	for _, tt := range tests {
+		if _, err := Verify(tt.payload, tt.signature, tt.publicKey); err == nil {
+			t.Errorf("%s: verified", tt.name)
+		}
+	}
+}
+
+func TestVerifyHeader(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := []byte("payload")
+
+	h := http.Header{}
+	if _, err := VerifyHeader(h, payload); err != ErrNotSigned {
+		t.Errorf("unsigned: err = %v, want ErrNotSigned", err)
+	}
+
+	signature, publicKey := Sign(key, payload)
+	h.Set(SignatureHeader, signature)
+	if _, err := VerifyHeader(h, payload); err != ErrNotSigned {
+		t.Errorf("without public key: err = %v, want ErrNotSigned", err)
+	}
+
+	h.Set(PublicKeyHeader, publicKey)
+	if _, err := VerifyHeader(h, payload); err != nil {
+		t.Errorf("signed: %v", err)
+	}
+	if _, err := VerifyHeader(h, []byte("other payload")); err == nil || err == ErrNotSigned {
+		t.Errorf("tampered: err = %v", err)
+	}
+}
@@ -70,6 +70,12 @@ type Data struct {
 		OpenwrtFeedsPackagesRevision string   `xml:"openwrt_feeds_packages_revision"`
 		VpnActive                    int      `xml:"vpn_active"`
 	} `xml:"system_data"`
+	ExtendedSystemData struct {
+		Load1    float64   `xml:"load1"`
+		Load5    float64   `xml:"load5"`
+		Load15   float64   `xml:"load15"`
+		CPUUsage *CPUUsage `xml:"cpu_usage,omitempty"`
+	} `xml:"extended_system_data"`
 	InterfaceData struct {
 		Interfaces []Interface `xml:",any"`
 	} `xml:"interface_data"`
@@ -90,6 +96,28 @@ type Data struct {
 	Clients     struct {
 		Num []ClientNum `xml:",any"`
 	} `xml:"clients"`
+	ClientBreakdown struct {
+		Interfaces []ClientBreakdown `xml:",any"`
+	} `xml:"client_breakdown"`
+	ClientSessions struct {
+		Interfaces []ClientSessions `xml:",any"`
+	} `xml:"client_sessions"`
+	Tunnels struct {
+		Tunnels []Tunnel `xml:"tunnel"`
+	} `xml:"tunnels"`
+}
+
+// CPUUsage is used for xml encoding. All values are in percent of the time
+// since the previous report.
+type CPUUsage struct {
+	User    float64 `xml:"user"`
+	Nice    float64 `xml:"nice"`
+	System  float64 `xml:"system"`
+	Iowait  float64 `xml:"iowait"`
+	IRQ     float64 `xml:"irq"`
+	SoftIRQ float64 `xml:"softirq"`
+	Steal   float64 `xml:"steal"`
+	Idle    float64 `xml:"idle"`
 }
 
 // BabelNeighbour is used for xml encoding
@@ -102,20 +130,35 @@ type BabelNeighbour struct {
 // Interface is used for xml encoding
 type Interface struct {
 	XMLName           xml.Name
-	Name              string   `xml:"name,omitempty"`
-	Mtu               int      `xml:"mtu,omitempty"`
-	MacAddr           string   `xml:"mac_addr,omitempty"`
-	TrafficRx         uint64   `xml:"traffic_rx,omitempty"`
-	TrafficTx         uint64   `xml:"traffic_tx,omitempty"`
-	IPv4Addr          []string `xml:"ipv4_addr,omitempty"`
-	IPv6Addr          []string `xml:"ipv6_addr,omitempty"`
-	IPv6LinkLocalAddr []string `xml:"ipv6_link_local_addr,omitempty"`
-	WlanMode          string   `xml:"wlan_mode,omitempty"`
-	WlanTxPower       string   `xml:"wlan_tx_power,omitempty"`
-	WlanSsid          string   `xml:"wlan_ssid,omitempty"`
-	WlanType          string   `xml:"wlan_type,omitempty"`
-	WlanChannel       string   `xml:"wlan_channel,omitempty"`
-	WlanWidth         string   `xml:"wlan_width,omitempty"`
+	Name              string          `xml:"name,omitempty"`
+	Mtu               int             `xml:"mtu,omitempty"`
+	MacAddr           string          `xml:"mac_addr,omitempty"`
+	TrafficRx         uint64          `xml:"traffic_rx,omitempty"`
+	TrafficTx         uint64          `xml:"traffic_tx,omitempty"`
+	RxErrors          uint64          `xml:"rx_errors,omitempty"`
+	TxErrors          uint64          `xml:"tx_errors,omitempty"`
+	RxDropped         uint64          `xml:"rx_dropped,omitempty"`
+	TxDropped         uint64          `xml:"tx_dropped,omitempty"`
+	Rates             *InterfaceRates `xml:"rates,omitempty"`
+	IPv4Addr          []string        `xml:"ipv4_addr,omitempty"`
+	IPv6Addr          []string        `xml:"ipv6_addr,omitempty"`
+	IPv6LinkLocalAddr []string        `xml:"ipv6_link_local_addr,omitempty"`
+	WlanMode          string          `xml:"wlan_mode,omitempty"`
+	WlanTxPower       string          `xml:"wlan_tx_power,omitempty"`
+	WlanSsid          string          `xml:"wlan_ssid,omitempty"`
+	WlanType          string          `xml:"wlan_type,omitempty"`
+	WlanChannel       string          `xml:"wlan_channel,omitempty"`
+	WlanWidth         string          `xml:"wlan_width,omitempty"`
+}
+
+// InterfaceRates is used for xml encoding. Rates are per second over the
+// interval in seconds since the previous report.
+type InterfaceRates struct {
+	Interval  float64 `xml:"interval"`
+	RxBytes   float64 `xml:"rx_bytes"`
+	TxBytes   float64 `xml:"tx_bytes"`
+	RxPackets float64 `xml:"rx_packets"`
+	TxPackets float64 `xml:"tx_packets"`
 }
 
 // BatmanAdvInterface is used for xml coding
@@ -146,12 +189,50 @@ type BatmanAdvGateway struct {
 	GwClass           string `xml:"gw_class,omitempty"`
 }
 
+// Tunnel is used for xml encoding
+type Tunnel struct {
+	Name   string       `xml:"name"`
+	Type   string       `xml:"type"`
+	Active int          `xml:"active"`
+	Peers  []TunnelPeer `xml:"peer,omitempty"`
+}
+
+// TunnelPeer is used for xml encoding
+type TunnelPeer struct {
+	PublicKey     string `xml:"public_key,omitempty"`
+	Endpoint      string `xml:"endpoint,omitempty"`
+	LastHandshake int64  `xml:"last_handshake,omitempty"`
+	Active        int    `xml:"active"`
+	TrafficRx     uint64 `xml:"traffic_rx,omitempty"`
+	TrafficTx     uint64 `xml:"traffic_tx,omitempty"`
+}
+
 // ClientNum is used for xml encoding
 type ClientNum struct {
 	XMLName xml.Name
 	N       int `xml:",chardata"`
 }
 
+// ClientBreakdown is used for xml encoding. Unique clients were seen on this
+// interface first, duplicates are also visible on an earlier interface and not
+// included in ClientCount.
+type ClientBreakdown struct {
+	XMLName   xml.Name
+	Unique    int `xml:"unique"`
+	Duplicate int `xml:"duplicate"`
+}
+
+// ClientSessions is used for xml encoding. New and Departed count the clients
+// that connected or left since the previous report, durations are in seconds.
+type ClientSessions struct {
+	XMLName             xml.Name
+	New                 int     `xml:"new"`
+	Departed            int     `xml:"departed"`
+	DurationAvg         float64 `xml:"duration_avg"`
+	DurationMax         float64 `xml:"duration_max"`
+	DepartedDurationAvg float64 `xml:"departed_duration_avg"`
+}
+
 // UnmarshalJSON decodes the xml embedded in the json string
 func (d *Data) UnmarshalJSON(b []byte) error {
 	if bytes.Equal([]byte("null"), b) {
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// clientHasher pseudonymizes client addresses wherever they appear in the
+// output. The salt is random, only kept in memory and replaced every day, so
+// hashes can't be reversed by enumerating hardware addresses and can't be
+// linked across days.
+type clientHasher struct {
+	mu   sync.Mutex
+	now  func() time.Time
+	day  string
+	salt []byte
+}
+
+// clientHash is shared by all output paths, so the same client gets the same
+// hash in logs, events and reports
+var clientHash = &clientHasher{now: time.Now}
+
+// currentSalt returns the salt of the current day, generating a new one on
+// the first call of each day
+func (h *clientHasher) currentSalt() []byte {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	day := h.now().UTC().Format("2006-01-02")
+	if day != h.day || h.salt == nil {
+		salt := make([]byte, sha256.Size)
+		if _, err := rand.Read(salt); err != nil {
+			panic(err)
+		}
+		h.day = day
+		h.salt = salt
+	}
+	return h.salt
+}
+
+func (h *clientHasher) sum(b []byte) string {
+	m := hmac.New(sha256.New, h.currentSalt())
+	m.Write(b)
+	return hex.EncodeToString(m.Sum(nil)[:8])
+}
+
+// id hashes a client identifier as returned by clientID
+func (h *clientHasher) id(id string) string {
+	return h.sum([]byte(id))
+}
+
+// mac hashes a client hardware address
+func (h *clientHasher) mac(mac net.HardwareAddr) string {
+	return h.id(clientID(mac))
+}
+
+// addr hashes a client IP address, which may embed the hardware address
+func (h *clientHasher) addr(addr netip.Addr) string {
+	return h.sum(addr.AsSlice())
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientHasherRotation(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	h := &clientHasher{now: func() time.Time { return now }}
+	mac := net.HardwareAddr{0x02, 0, 0, 0, 0, 0x01}
+
+	first := h.mac(mac)
+	if got := h.mac(mac); got != first {
+		t.Errorf("hash changed within a day: %s, %s", first, got)
+	}
+	if got := h.id(clientID(mac)); got != first {
+		t.Errorf("id hash %s differs from mac hash %s", got, first)
+	}
+
+	now = now.Add(24 * time.Hour)
+	if got := h.mac(mac); got == first {
+		t.Errorf("hash not rotated after a day: %s", got)
+	}
+}
+
+func TestClientHasherAddr(t *testing.T) {
+	h := &clientHasher{now: time.Now}
+	addr := netip.MustParseAddr("192.0.2.10")
+
+	got := h.addr(addr)
+	if strings.Contains(got, addr.String()) || len(got) != 16 {
+		t.Errorf("addr(%s) = %q", addr, got)
+	}
+	if h.addr(netip.MustParseAddr("192.0.2.11")) == got {
+		t.Error("different addresses share a hash")
+	}
+}
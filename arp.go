@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+// ARP constants from RFC 826
+const (
+	arpHTypeEthernet = 1
+	arpOpRequest     = 1
+	arpOpReply       = 2
+	arpPacketLen     = 28
+)
+
+// arp sends ARP requests and reads replies on a single interface
+type arp struct {
+	fd    int
+	iface net.Interface
+}
+
+// htons converts v to network byte order, as expected by AF_PACKET sockets
+func htons(v uint16) uint16 {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], v)
+	return nl.NativeEndian().Uint16(b[:])
+}
+
+func newARP(iface net.Interface) (arp, error) {
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, int(htons(unix.ETH_P_ARP)))
+	if err != nil {
+		return arp{}, err
+	}
+
+	if err := unix.Bind(fd, &unix.SockaddrLinklayer{
+		Protocol: htons(unix.ETH_P_ARP),
+		Ifindex:  iface.Index,
+	}); err != nil {
+		unix.Close(fd)
+		return arp{}, err
+	}
+
+	return arp{fd: fd, iface: iface}, nil
+}
+
+func (a arp) Close() error {
+	return unix.Close(a.fd)
+}
+
+// arpReply is a parsed reply to an ARP request
+type arpReply struct {
+	target netip.Addr
+	mac    net.HardwareAddr
+	rtt    time.Duration
+}
+
+func arpRequest(from net.HardwareAddr, src, target netip.Addr) []byte {
+	b := make([]byte, 8, arpPacketLen)
+	binary.BigEndian.PutUint16(b[0:], arpHTypeEthernet)
+	binary.BigEndian.PutUint16(b[2:], unix.ETH_P_IP)
+	b[4] = 6 // hardware address length
+	b[5] = 4 // protocol address length
+	binary.BigEndian.PutUint16(b[6:], arpOpRequest)
+	b = append(b, from...)
+	b = append(b, src.AsSlice()...)
+	b = append(b, make([]byte, 6)...)
+	b = append(b, target.AsSlice()...)
+	return b
+}
+
+// parseARPReply returns the sender of an ARP reply. ok is false for any other
+// packet.
+func parseARPReply(b []byte) (reply arpReply, ok bool) {
+	if len(b) < arpPacketLen ||
+		binary.BigEndian.Uint16(b[0:]) != arpHTypeEthernet ||
+		binary.BigEndian.Uint16(b[2:]) != unix.ETH_P_IP ||
+		b[4] != 6 || b[5] != 4 ||
+		binary.BigEndian.Uint16(b[6:]) != arpOpReply {
+		return reply, false
+	}
+
+	reply.mac = net.HardwareAddr(append([]byte(nil), b[8:14]...))
+	reply.target, ok = netip.AddrFromSlice(b[14:18])
+	return reply, ok
+}
+
+// probe broadcasts ARP requests for all IPv4 targets and collects the matching
+// replies until all targets answered or the timeout expired. src is used as
+// the sender address and may be the unspecified address.
+func (a arp) probe(timeout time.Duration, src netip.Addr, targets ...netip.Addr) ([]arpReply, error) {
+	if !src.Is4() {
+		src = netip.IPv4Unspecified()
+	}
+
+	broadcast := &unix.SockaddrLinklayer{
+		Protocol: htons(unix.ETH_P_ARP),
+		Ifindex:  a.iface.Index,
+		Halen:    6,
+		Addr:     [8]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+	}
+
+	sent := time.Now()
+	pending := map[netip.Addr]struct{}{}
+	for _, target := range targets {
+		target = target.Unmap()
+		if !target.Is4() {
+			// skip v6 addresses
+			continue
+		}
+		if _, ok := pending[target]; ok {
+			continue
+		}
+		if err := unix.Sendto(a.fd, arpRequest(a.iface.HardwareAddr, src, target), 0, broadcast); err != nil {
+			return nil, fmt.Errorf("arp request to %s: %w", clientHash.addr(target), err)
+		}
+		pending[target] = struct{}{}
+	}
+
+	var replies []arpReply
+	buf := make([]byte, 1500)
+	deadline := sent.Add(timeout)
+	for len(pending) > 0 {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			break
+		}
+
+		fds := []unix.PollFd{{Fd: int32(a.fd), Events: unix.POLLIN}}
+		n, err := unix.Poll(fds, int(remaining/time.Millisecond)+1)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			break
+		}
+
+		c, _, err := unix.Recvfrom(a.fd, buf, unix.MSG_DONTWAIT)
+		if err == unix.EAGAIN || err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		reply, ok := parseARPReply(buf[:c])
+		if !ok {
+			continue
+		}
+		if _, ok := pending[reply.target]; !ok {
+			continue
+		}
+		delete(pending, reply.target)
+
+		reply.rtt = time.Since(sent)
+		replies = append(replies, reply)
+	}
+
+	return replies, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"testing"
+	"unsafe"
+)
+
+func TestHtons(t *testing.T) {
+	v := htons(0x0806)
+	// the in-memory representation must be in network byte order on every
+	// host
+	b := (*[2]byte)(unsafe.Pointer(&v))
+	if got := binary.BigEndian.Uint16(b[:]); got != 0x0806 {
+		t.Errorf("htons(0x0806) is stored as %#04x", got)
+	}
+}
+
+func TestARPRequest(t *testing.T) {
+	from := net.HardwareAddr{0x02, 0, 0, 0, 0, 0x01}
+	src := netip.MustParseAddr("192.0.2.1")
+	target := netip.MustParseAddr("192.0.2.10")
+
+	want := []byte{
+		0x00, 0x01, // ethernet
+		0x08, 0x00, // ipv4
+		6, 4,
+		0x00, 0x01, // request
+		0x02, 0, 0, 0, 0, 0x01, 192, 0, 2, 1,
+		0, 0, 0, 0, 0, 0, 192, 0, 2, 10,
+	}
+	if got := arpRequest(from, src, target); !bytes.Equal(got, want) {
+		t.Errorf("arpRequest() = % x, want % x", got, want)
+	}
+}
+
+func TestParseARPReply(t *testing.T) {
+	reply := []byte{
+		0x00, 0x01, 0x08, 0x00, 6, 4,
+		0x00, 0x02, // reply
+		0x02, 0, 0, 0, 0, 0x0a, 192, 0, 2, 10,
+		0x02, 0, 0, 0, 0, 0x01, 192, 0, 2, 1,
+	}
+
+	r, ok := parseARPReply(reply)
+	if !ok {
+		t.Fatal("reply not parsed")
+	}
+	if r.target != netip.MustParseAddr("192.0.2.10") || r.mac.String() != "02:00:00:00:00:0a" {
+		t.Errorf("parseARPReply() = %s %s", r.target, r.mac)
+	}
+
+	// the sender address must not alias the packet buffer
+	reply[8] = 0xff
+	if r.mac[0] != 0x02 {
+		t.Error("mac aliases the packet buffer")
+	}
+
+	request := arpRequest(net.HardwareAddr{0x02, 0, 0, 0, 0, 0x01}, netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("192.0.2.10"))
+	for name, b := range map[string][]byte{
+		"request": request,
+		"short":   reply[:arpPacketLen-1],
+	} {
+		if r, ok := parseARPReply(b); ok {
+			t.Errorf("%s: parsed %+v", name, r)
+		}
+	}
+}
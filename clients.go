@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/xml"
+	"net"
+
+	alfredxml "github.com/lemmi/gnw/alfredxml"
+)
+
+// ifaceClients holds the client hardware addresses found on one interface
+type ifaceClients struct {
+	name string
+	macs []net.HardwareAddr
+}
+
+// dedupClients counts every client only once across all interfaces. A client
+// visible on several interfaces, e.g. a bridge and its VLAN sub-interface, is
+// attributed to the first interface it appears on and reported as a duplicate
+// on the others. Interfaces are expected in report order, so the client
+// interface takes precedence.
+func dedupClients(clients []ifaceClients) (int, []alfredxml.ClientBreakdown) {
+	seen := map[string]bool{}
+	breakdown := make([]alfredxml.ClientBreakdown, 0, len(clients))
+	for _, ic := range clients {
+		b := alfredxml.ClientBreakdown{
+			XMLName: xml.Name{
+				Local: ic.name,
+			},
+		}
+		for _, mac := range ic.macs {
+			key := mac.String()
+			if seen[key] {
+				b.Duplicate++
+				continue
+			}
+			seen[key] = true
+			b.Unique++
+		}
+		breakdown = append(breakdown, b)
+	}
+	return len(seen), breakdown
+}
+
+// mergeClients returns the distinct hardware addresses of a and b
+func mergeClients(a, b []net.HardwareAddr) []net.HardwareAddr {
+	seen := make(map[string]bool, len(a)+len(b))
+	merged := make([]net.HardwareAddr, 0, len(a)+len(b))
+	for _, macs := range [][]net.HardwareAddr{a, b} {
+		for _, mac := range macs {
+			if seen[mac.String()] {
+				continue
+			}
+			seen[mac.String()] = true
+			merged = append(merged, mac)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	alfredxml "github.com/lemmi/gnw/alfredxml"
+)
+
+func testMAC(b byte) net.HardwareAddr {
+	return net.HardwareAddr{0x02, 0, 0, 0, 0, b}
+}
+
+func TestDedupClients(t *testing.T) {
+	total, breakdown := dedupClients([]ifaceClients{
+		{name: "br-client", macs: []net.HardwareAddr{testMAC(1), testMAC(2)}},
+		{name: "br-client.5", macs: []net.HardwareAddr{testMAC(2), testMAC(3)}},
+		{name: "eth0", macs: []net.HardwareAddr{testMAC(1)}},
+		{name: "wlan0"},
+	})
+	if total != 3 {
+		t.Errorf("total = %d, want 3", total)
+	}
+
+	var got [][3]interface{}
+	for _, b := range breakdown {
+		got = append(got, [3]interface{}{b.XMLName.Local, b.Unique, b.Duplicate})
+	}
+	want := [][3]interface{}{
+		{"br-client", 2, 0},
+		{"br-client.5", 1, 1},
+		{"eth0", 0, 1},
+		{"wlan0", 0, 0},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("breakdown = %v, want %v", got, want)
+	}
+}
+
+func TestDedupClientsEmpty(t *testing.T) {
+	total, breakdown := dedupClients(nil)
+	if total != 0 || !reflect.DeepEqual(breakdown, []alfredxml.ClientBreakdown{}) {
+		t.Errorf("dedupClients(nil) = %d, %v", total, breakdown)
+	}
+}
+
+func TestMergeClients(t *testing.T) {
+	got := mergeClients(
+		[]net.HardwareAddr{testMAC(1), testMAC(2)},
+		[]net.HardwareAddr{testMAC(2), testMAC(3)},
+	)
+	want := []net.HardwareAddr{testMAC(1), testMAC(2), testMAC(3)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeClients() = %v, want %v", got, want)
+	}
+}
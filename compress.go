@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compress encodes the payload with the given content encoding. An empty
+// encoding returns the payload as is.
+func compress(encoding string, payload []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	switch encoding {
+	case "":
+		return payload, nil
+	case "gzip":
+		w, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(payload); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	case "zstd":
+		// reports are small, a single goroutine and a small window keep the
+		// encoder's memory use low on routers
+		w, err := zstd.NewWriter(nil,
+			zstd.WithEncoderLevel(zstd.SpeedBetterCompression),
+			zstd.WithEncoderConcurrency(1),
+			zstd.WithWindowSize(1<<20),
+		)
+		if err != nil {
+			return nil, err
+		}
+		defer w.Close()
+		return w.EncodeAll(payload, nil), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", encoding)
+	}
+
+	return buf.Bytes(), nil
+}
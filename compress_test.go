@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/lemmi/gnw/alfredxml"
+)
+
+func TestCompress(t *testing.T) {
+	payload := []byte(strings.Repeat(`{"02:00:00:00:00:01":"<data/>"}`, 100))
+
+	for _, encoding := range []string{"", "gzip", "zstd"} {
+		compressed, err := compress(encoding, payload)
+		if err != nil {
+			t.Fatalf("%q: %v", encoding, err)
+		}
+		if encoding != "" && len(compressed) >= len(payload) {
+			t.Errorf("%q: compressed %d bytes to %d", encoding, len(payload), len(compressed))
+		}
+
+		body, err := alfredxml.DecodeBody(bytes.NewReader(compressed), encoding, 0)
+		if err != nil {
+			t.Fatalf("%q: %v", encoding, err)
+		}
+		got, err := io.ReadAll(body)
+		if err != nil {
+			t.Fatalf("%q: %v", encoding, err)
+		}
+		if !bytes.Equal(got, payload) {
+			t.Errorf("%q: round trip differs", encoding)
+		}
+	}
+
+	if _, err := compress("br", payload); err == nil {
+		t.Error("unsupported compression accepted")
+	}
+}
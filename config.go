@@ -1,37 +1,91 @@
 package main
 
 import (
+	"crypto/ed25519"
 	"encoding/json"
 	"flag"
 	"fmt"
-	"log"
-	"log/syslog"
+	"log/slog"
+	"net/http"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 
+	"github.com/BurntSushi/toml"
 	"github.com/lemmi/closer"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultEndpoint = "https://monitoring.freifunk-franken.de/api/alfred2"
+	defaultConfig   = "gateway.json"
+	defaultUCI      = "/etc/config/gnw"
+	defaultProcRoot = "/proc"
+	defaultSysRoot  = "/sys"
+	defaultEtcRoot  = "/etc"
 )
 
 // Config holds user values and overrides
 type Config struct {
-	Hostname        string
-	Description     string
-	Lat             float64
-	Lng             float64
-	PositionComment string
-	Contact         string
-	Hood            string
-	Distname        string
-	Distversion     string
-	Config          string
-	ClientIfName    string
-	RenameClientIf  bool
-	Dry             bool
-	Debug           bool
-	Syslog          bool
-
-	Log *log.Logger
+	Hostname                     string
+	Description                  string
+	Lat                          float64
+	Lng                          float64
+	PositionComment              string
+	Contact                      string
+	Hood                         string
+	Hoods                        string
+	Hoodid                       string
+	HoodFile                     string
+	Distname                     string
+	Distversion                  string
+	FirmwareVersion              string
+	FirmwareRevision             string
+	OpenwrtCoreRevision          string
+	OpenwrtFeedsPackagesRevision string
+	Config                       string
+	UCI                          string
+	ClientIfName                 string
+	RenameClientIf               bool
+	Discover                     string
+	CountMethods                 string
+	FdbIgnorePorts               string
+	ClientEvents                 string
+	Dry                          bool
+	Debug                        bool
+	Syslog                       bool
+	Journald                     bool
+	LogFormat                    string
+	MaxFailures                  uint
+	Proxy                        string
+	CACert                       string
+	ClientCert                   string
+	ClientKey                    string
+	TLSMinVersion                string
+	SourceAddr                   string
+	SourceIf                     string
+	VpnIfNames                   string
+	KeyFile                      string
+	ForwarderKeys                string
+	Endpoint                     string
+	Compression                  string
+	Listen                       string
+	DropDir                      string
+	ProcRoot                     string
+	SysRoot                      string
+	EtcRoot                      string
+
+	Log    *slog.Logger
+	Client *http.Client
+	Key    ed25519.PrivateKey
+
+	// CountBy maps interfaces to their client counting method, parsed from
+	// CountMethods
+	CountBy map[string]string
+
+	// Origins maps each set option to the source it was taken from
+	Origins map[string]string
 }
 
 func strOr(value, def string) string {
@@ -40,32 +94,54 @@ func strOr(value, def string) string {
 	}
 	return value
 }
-func floatOr(value, def float64) float64 {
-	if value == 0 {
-		value = def
-	}
-	return value
+
+// configSource is a partial configuration together with the fields it
+// explicitly sets, so that zero values like a latitude of 0 or a false flag
+// can override other sources
+type configSource struct {
+	name   string
+	config Config
+	set    map[string]bool
 }
-func configOr(conf, def Config) Config {
-	conf.Hostname = strOr(conf.Hostname, def.Hostname)
-	conf.Description = strOr(conf.Description, def.Description)
-	conf.Lat = floatOr(conf.Lat, def.Lat)
-	conf.Lng = floatOr(conf.Lng, def.Lng)
-	conf.PositionComment = strOr(conf.PositionComment, def.PositionComment)
-	conf.Contact = strOr(conf.Contact, def.Contact)
-	conf.Hood = strOr(conf.Hood, def.Hood)
-	conf.Distname = strOr(conf.Distname, def.Distname)
-	conf.Distversion = strOr(conf.Distversion, def.Distversion)
-	conf.Config = strOr(conf.Config, def.Config)
-	conf.ClientIfName = strOr(conf.ClientIfName, def.ClientIfName)
-	conf.RenameClientIf = conf.RenameClientIf || def.RenameClientIf
-	conf.Syslog = conf.Syslog || def.Syslog
-
-	return conf
+
+func newConfigSource(name string) configSource {
+	return configSource{
+		name: name,
+		set:  map[string]bool{},
+	}
 }
 
-func configFromCmd() Config {
+// configMerge takes every field from the first source that sets it. It returns
+// the merged config and the name of the source of each set field.
+func configMerge(sources ...configSource) (Config, map[string]string) {
 	var c Config
+	origins := map[string]string{}
+
+	v := reflect.ValueOf(&c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Name
+		for _, s := range sources {
+			if !s.set[name] {
+				continue
+			}
+			v.Field(i).Set(reflect.ValueOf(s.config).Field(i))
+			origins[name] = s.name
+			break
+		}
+	}
+
+	return c, origins
+}
+
+// flags that are not named after their field
+var flagFields = map[string]string{
+	"d": "Debug",
+}
+
+func configFromCmd(args []string) configSource {
+	s := newConfigSource("flag")
+	c := &s.config
 
 	flag.StringVar(&c.Hostname, "hostname", "", "Hostname to report")
 	flag.StringVar(&c.Description, "description", "", "Router description")
@@ -74,41 +150,104 @@ func configFromCmd() Config {
 	flag.StringVar(&c.PositionComment, "positioncomment", "", "Position comment")
 	flag.StringVar(&c.Contact, "contact", "", "Contact information")
 	flag.StringVar(&c.Hood, "hood", "", "Name of the Hood")
+	flag.StringVar(&c.Hoods, "hoods", "", "Comma separated list of known hoods to check Hood against")
+	flag.StringVar(&c.Hoodid, "hoodid", "", "ID of the Hood")
+	flag.StringVar(&c.HoodFile, "hoodfile", "", "JSON file with hood definitions to derive Hood and Hoodid from the position")
 	flag.StringVar(&c.Distname, "distname", "", "Name of the distribution")
 	flag.StringVar(&c.Distversion, "distversion", "", "Version of the distribution")
-	flag.StringVar(&c.Config, "config", "gateway.json", "Config file to load")
+	flag.StringVar(&c.FirmwareVersion, "firmwareversion", "", "Firmware version (default from os-release)")
+	flag.StringVar(&c.FirmwareRevision, "firmwarerevision", "", "Firmware revision (default from os-release)")
+	flag.StringVar(&c.OpenwrtCoreRevision, "openwrtcorerevision", "", "OpenWrt core revision (default from openwrt_release)")
+	flag.StringVar(&c.OpenwrtFeedsPackagesRevision, "openwrtfeedspackagesrevision", "", "OpenWrt packages feed revision")
+	flag.StringVar(&c.Config, "config", "", "Config file to load, format by extension: .json, .toml, .yaml (default "+defaultConfig+")")
+	flag.StringVar(&c.UCI, "uci", "", "OpenWrt UCI config file to load (default "+defaultUCI+")")
 	flag.StringVar(&c.ClientIfName, "clientifname", "", "Name of the main client interface")
 	flag.BoolVar(&c.RenameClientIf, "renameclientif", false, "Rename main client interface to br-mesh")
+	flag.StringVar(&c.Discover, "discover", "", "Actively discover silent clients: echo, mld or echo,mld")
+	flag.StringVar(&c.CountMethods, "countmethods", "", "Comma separated client counting methods per interface, e.g. br-client=fdb (neigh or fdb, default neigh)")
+	flag.StringVar(&c.FdbIgnorePorts, "fdbignoreports", "", "Comma separated name patterns of bridge ports not counted by the fdb method, e.g. bat*,vx*")
+	flag.StringVar(&c.ClientEvents, "clientevents", "", "Emit client connect and disconnect events to the log (\"log\") or post them to this URL")
 	flag.BoolVar(&c.Dry, "dry", false, "Don't send the report")
 	flag.BoolVar(&c.Debug, "d", false, "Print debug information")
 	flag.BoolVar(&c.Syslog, "syslog", false, "Use the syslog")
+	flag.BoolVar(&c.Journald, "journald", false, "Log to stderr with severity prefixes for journald")
+	flag.StringVar(&c.LogFormat, "logformat", "", "Log format: logfmt or json (default logfmt)")
+	flag.UintVar(&c.MaxFailures, "maxfailures", 0, "Exit after this many consecutive failed crawls (0 to never exit)")
+	flag.StringVar(&c.Proxy, "proxy", "", "HTTP proxy URL (defaults to $HTTPS_PROXY)")
+	flag.StringVar(&c.CACert, "cacert", "", "PEM file with CA certificates to trust")
+	flag.StringVar(&c.ClientCert, "clientcert", "", "PEM file with the TLS client certificate")
+	flag.StringVar(&c.ClientKey, "clientkey", "", "PEM file with the TLS client key")
+	flag.StringVar(&c.TLSMinVersion, "tlsminversion", "", "Minimum TLS version (1.0, 1.1, 1.2, 1.3)")
+	flag.StringVar(&c.SourceAddr, "sourceaddr", "", "Source address for outgoing connections")
+	flag.StringVar(&c.SourceIf, "sourceif", "", "Bind outgoing connections to this interface")
+	flag.StringVar(&c.VpnIfNames, "vpnifnames", "", "Comma separated name patterns of additional tunnel interfaces, e.g. fastd*,tun0")
+	flag.StringVar(&c.KeyFile, "keyfile", "", "Sign reports with the ed25519 key in this file, generated if missing")
+	flag.StringVar(&c.Endpoint, "endpoint", "", "URL of the alfred2 endpoint (default "+defaultEndpoint+")")
+	flag.StringVar(&c.Compression, "compression", "", "Compress reports sent to the endpoint (gzip, zstd)")
+	flag.StringVar(&c.Listen, "listen", "", "Accept reports from other nodes on this address and forward them")
+	flag.StringVar(&c.ForwarderKeys, "forwarderkeys", "", "Comma separated base64 ed25519 public keys of the nodes allowed to send reports to -listen")
+	flag.StringVar(&c.DropDir, "dropdir", "", "Forward reports from other nodes dropped as *.json into this directory, write them to a temporary name and rename (batches containing them are not signed)")
+	flag.StringVar(&c.ProcRoot, "procroot", "", "Mount point of procfs (default "+defaultProcRoot+")")
+	flag.StringVar(&c.SysRoot, "sysroot", "", "Mount point of sysfs (default "+defaultSysRoot+")")
+	flag.StringVar(&c.EtcRoot, "etcroot", "", "Directory containing os-release and openwrt_release (default "+defaultEtcRoot+")")
+
+	// flag.CommandLine exits on errors
+	_ = flag.CommandLine.Parse(args)
 
-	flag.Parse()
+	flag.Visit(func(f *flag.Flag) {
+		name := strOr(flagFields[f.Name], f.Name)
+		if _, field, ok := configField(c, name); ok {
+			s.set[field] = true
+		}
+	})
 
-	return c
+	return s
 }
 
-func configFromFile(path string) (Config, error) {
-	var c Config
+func configFromFile(path string) (configSource, error) {
+	s := newConfigSource("file")
 	if path == "" {
-		return c, nil
+		return s, nil
 	}
 
 	f, err := os.Open(path)
 	switch {
 	case os.IsNotExist(err):
-		return c, nil
+		return s, nil
 	case err != nil:
-		return c, err
+		return s, err
 	}
 	defer closer.Do(f)
 
-	return c, json.NewDecoder(f).Decode(&c)
+	// decode into a map first to learn which options are present
+	var values map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		_, err = toml.NewDecoder(f).Decode(&values)
+	case ".yaml", ".yml":
+		err = yaml.NewDecoder(f).Decode(&values)
+	default:
+		err = json.NewDecoder(f).Decode(&values)
+	}
+	if err != nil {
+		return s, err
+	}
+
+	var errors errors
+	for name, value := range values {
+		if err := s.assign(name, value); err != nil {
+			errors = append(errors, err)
+		}
+	}
+	if len(errors) > 0 {
+		return s, errors
+	}
+	return s, nil
 }
 
-func configRequire(errors errors, option interface{}, name string) errors {
-	zero := reflect.Zero(reflect.TypeOf(option))
-	if option != zero.Interface() {
+func configRequire(errors errors, c Config, origins map[string]string, name string) errors {
+	option, _, _ := configField(&c, name)
+	if origins[name] != "" && !(option.Kind() == reflect.String && option.String() == "") {
 		return errors
 	}
 	err := fmt.Errorf("option %q is required", name)
@@ -126,33 +265,89 @@ func (es errors) Error() string {
 	return ret.String()
 }
 
-func getConfig() (Config, error) {
-	fromCmd := configFromCmd()
-	fromFile, err := configFromFile(fromCmd.Config)
+// getConfig merges all configuration sources. Values are taken from the first
+// source that sets them, in this order:
+//
+//  1. command line flags
+//  2. GNW_<OPTION> environment variables
+//  3. the config file given by -config (JSON, TOML or YAML)
+//  4. the UCI config file given by -uci
+//  5. built-in defaults and os.Hostname
+func getConfig(args []string) (Config, error) {
+	fromCmd := configFromCmd(args)
+	fromEnv, err := configFromEnv()
 	if err != nil {
-		return fromCmd, err
+		fromCmd.config.Log = newLogger(fromCmd.config)
+		return fromCmd.config, err
 	}
 
-	c := configOr(fromCmd, fromFile)
-	hostname, _ := os.Hostname()
-	c.Hostname = strOr(c.Hostname, hostname)
+	c, _ := configMerge(fromCmd, fromEnv)
+	fromFile, err := configFromFile(strOr(c.Config, defaultConfig))
+	if err != nil {
+		c.Log = newLogger(c)
+		return c, err
+	}
+	fromUCI, err := configFromUCI(strOr(c.UCI, defaultUCI))
+	if err != nil {
+		c.Log = newLogger(c)
+		return c, err
+	}
 
-	var errors errors
-	errors = configRequire(errors, c.Hostname, "Hostname")
-	errors = configRequire(errors, c.Lat, "Lat")
-	errors = configRequire(errors, c.Lng, "Lng")
-	errors = configRequire(errors, c.Contact, "Contact")
-	errors = configRequire(errors, c.Hood, "Hood")
-
-	if c.Syslog {
-		c.Log, err = syslog.NewLogger(syslog.LOG_NOTICE|syslog.LOG_DAEMON, log.LstdFlags)
-		if err != nil {
-			log.Println("Can't open syslog, falling back to normal logger")
-			log.Println(err)
-		}
+	fromRelease, err := configFromRelease(strOr(c.EtcRoot, defaultEtcRoot))
+	if err != nil {
+		c.Log = newLogger(c)
+		return c, err
+	}
+
+	defaults := newConfigSource("default")
+	defaults.config.Config = defaultConfig
+	defaults.config.UCI = defaultUCI
+	defaults.config.Endpoint = defaultEndpoint
+	defaults.config.ProcRoot = defaultProcRoot
+	defaults.config.SysRoot = defaultSysRoot
+	defaults.config.EtcRoot = defaultEtcRoot
+	defaults.config.FirmwareVersion = "Generic"
+	defaults.set["Config"] = true
+	defaults.set["UCI"] = true
+	defaults.set["Endpoint"] = true
+	defaults.set["ProcRoot"] = true
+	defaults.set["SysRoot"] = true
+	defaults.set["EtcRoot"] = true
+	defaults.set["FirmwareVersion"] = true
+
+	fromHostname := newConfigSource("os.Hostname")
+	if hostname, err := os.Hostname(); err == nil {
+		// only the host part is a valid DNS label
+		fromHostname.config.Hostname = strings.SplitN(hostname, ".", 2)[0]
+		fromHostname.set["Hostname"] = true
+	}
+
+	c, origins := configMerge(fromCmd, fromEnv, fromFile, fromUCI, fromRelease, defaults, fromHostname)
+	c.Origins = origins
+
+	if flag.NArg() > 0 {
+		c.Log = newLogger(c)
+		return c, fmt.Errorf("unexpected arguments: %s", strings.Join(flag.Args(), " "))
 	}
-	if c.Log == nil {
-		c.Log = log.New(os.Stdout, "gnw: ", log.LstdFlags)
+
+	c, warnings, err := configHoods(c)
+	c.Log = newLogger(c)
+	if err != nil {
+		return c, err
+	}
+	for _, w := range warnings {
+		c.Log.Warn(w)
+	}
+
+	var errors errors
+	errors = configRequire(errors, c, origins, "Hostname")
+	errors = configRequire(errors, c, origins, "Lat")
+	errors = configRequire(errors, c, origins, "Lng")
+	errors = configRequire(errors, c, origins, "Contact")
+	errors = configRequire(errors, c, origins, "Hood")
+	errors = configValidate(errors, c, origins)
+	if c.CountBy, err = countMethods(c); err != nil {
+		errors = append(errors, err)
 	}
 
 	if len(errors) == 0 {
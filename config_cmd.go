@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+)
+
+type configValue struct {
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+}
+
+// configDump lists every option with its effective value and source
+func configDump(c Config) map[string]configValue {
+	dump := map[string]configValue{}
+
+	t := reflect.TypeOf(c)
+	for i := 0; i < t.NumField(); i++ {
+		field, name, ok := configField(&c, t.Field(i).Name)
+		if !ok {
+			continue
+		}
+		source := c.Origins[name]
+		if source == "" {
+			source = "unset"
+		}
+		dump[name] = configValue{
+			Value:  field.Interface(),
+			Source: source,
+		}
+	}
+
+	return dump
+}
+
+// configCommand runs the "config check" and "config dump" subcommands and
+// returns the exit code
+func configCommand(c Config, err error, sub string) int {
+	switch sub {
+	case "check":
+	case "dump":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(configDump(c)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown config command %q, expected check or dump\n", sub)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprint(os.Stderr, err)
+		if _, ok := err.(errors); !ok {
+			fmt.Fprintln(os.Stderr)
+		}
+		return 1
+	}
+	if sub == "check" {
+		fmt.Println("config ok")
+	}
+	return 0
+}
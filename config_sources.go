@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/lemmi/closer"
+)
+
+// configField returns the settable field of c that matches name case
+// insensitively, together with the field's name. Only plain string, number and
+// bool fields are considered.
+func configField(c *Config, name string) (reflect.Value, string, bool) {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if !strings.EqualFold(t.Field(i).Name, name) {
+			continue
+		}
+		switch t.Field(i).Type.Kind() {
+		case reflect.String, reflect.Float64, reflect.Bool, reflect.Uint:
+			return v.Field(i), t.Field(i).Name, true
+		}
+	}
+	return reflect.Value{}, "", false
+}
+
+// parse parses value into the option name and marks it as set
+func (s *configSource) parse(name, value string) error {
+	field, fieldName, ok := configField(&s.config, name)
+	if !ok {
+		return fmt.Errorf("unknown option %q", name)
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("option %q: %v", name, err)
+		}
+		field.SetFloat(f)
+	case reflect.Bool:
+		b, err := parseBool(value)
+		if err != nil {
+			return fmt.Errorf("option %q: %v", name, err)
+		}
+		field.SetBool(b)
+	case reflect.Uint:
+		u, err := strconv.ParseUint(value, 10, 0)
+		if err != nil {
+			return fmt.Errorf("option %q: %v", name, err)
+		}
+		field.SetUint(u)
+	}
+
+	s.set[fieldName] = true
+	return nil
+}
+
+// assign sets the option name from a value decoded from a JSON, TOML or YAML
+// file and marks it as set
+func (s *configSource) assign(name string, value interface{}) error {
+	field, fieldName, ok := configField(&s.config, name)
+	if !ok {
+		return fmt.Errorf("unknown option %q", name)
+	}
+
+	var number float64
+	switch v := value.(type) {
+	case string:
+		return s.parse(name, v)
+	case bool:
+		if field.Kind() != reflect.Bool {
+			return fmt.Errorf("option %q: invalid value %v", name, value)
+		}
+		field.SetBool(v)
+		s.set[fieldName] = true
+		return nil
+	case float64:
+		number = v
+	case int:
+		number = float64(v)
+	case int64:
+		number = float64(v)
+	case uint64:
+		number = float64(v)
+	default:
+		return fmt.Errorf("option %q: unsupported value %v", name, value)
+	}
+
+	switch {
+	case field.Kind() == reflect.Float64:
+		field.SetFloat(number)
+	case field.Kind() == reflect.Uint && number >= 0 && number == math.Trunc(number):
+		field.SetUint(uint64(number))
+	default:
+		return fmt.Errorf("option %q: invalid value %v", name, value)
+	}
+
+	s.set[fieldName] = true
+	return nil
+}
+
+// parseBool extends strconv.ParseBool with the yes/no and on/off spellings
+// common in UCI files
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "yes", "on":
+		return true, nil
+	case "no", "off":
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// configFromEnv reads options from GNW_<OPTION> environment variables, e.g.
+// GNW_HOSTNAME or GNW_LAT
+func configFromEnv() (configSource, error) {
+	s := newConfigSource("env")
+	var errors errors
+
+	t := reflect.TypeOf(s.config)
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Name
+		value, ok := os.LookupEnv("GNW_" + strings.ToUpper(name))
+		if !ok {
+			continue
+		}
+		if _, _, ok := configField(&s.config, name); !ok {
+			continue
+		}
+		if err := s.parse(name, value); err != nil {
+			errors = append(errors, fmt.Errorf("GNW_%s: %v", strings.ToUpper(name), err))
+		}
+	}
+
+	if len(errors) > 0 {
+		return s, errors
+	}
+	return s, nil
+}
+
+// configFromUCI reads the options of all "gnw" sections of an OpenWrt UCI
+// config file:
+//
+//	config gnw 'main'
+//		option hostname 'node1'
+//		option lat '49.45'
+func configFromUCI(path string) (configSource, error) {
+	s := newConfigSource("uci")
+	if path == "" {
+		return s, nil
+	}
+
+	f, err := os.Open(path)
+	switch {
+	case os.IsNotExist(err):
+		return s, nil
+	case err != nil:
+		return s, err
+	}
+	defer closer.Do(f)
+
+	return s, s.parseUCI(f)
+}
+
+func (s *configSource) parseUCI(r io.Reader) error {
+	var errors errors
+	var section bool
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields, err := uciFields(scanner.Text())
+		if err != nil {
+			errors = append(errors, fmt.Errorf("line %d: %v", line, err))
+			continue
+		}
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "config":
+			section = len(fields) > 1 && fields[1] == "gnw"
+		case "option":
+			if !section {
+				continue
+			}
+			if len(fields) != 3 {
+				errors = append(errors, fmt.Errorf("line %d: malformed option", line))
+				continue
+			}
+			if err := s.parse(fields[1], fields[2]); err != nil {
+				errors = append(errors, fmt.Errorf("line %d: %v", line, err))
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if len(errors) > 0 {
+		return errors
+	}
+	return nil
+}
+
+// uciFields splits a UCI line into its words, honoring single and double
+// quotes and stripping comments
+func uciFields(line string) ([]string, error) {
+	var fields []string
+	var field strings.Builder
+	var quote rune
+	var inField bool
+
+	for _, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			field.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote = r
+			inField = true
+		case r == '#':
+			if inField {
+				fields = append(fields, field.String())
+			}
+			return fields, nil
+		case r == ' ' || r == '\t':
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		default:
+			field.WriteRune(r)
+			inField = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+	return fields, nil
+}
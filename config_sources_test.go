@@ -0,0 +1,35 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUCIFields(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+		err  bool
+	}{
+		{"", nil, false},
+		{"# comment", nil, false},
+		{"config gnw 'main'", []string{"config", "gnw", "main"}, false},
+		{"\toption hostname 'node1'", []string{"option", "hostname", "node1"}, false},
+		{`option description "Node in the attic"`, []string{"option", "description", "Node in the attic"}, false},
+		{`option contact "it's me"`, []string{"option", "contact", "it's me"}, false},
+		{"option description ''", []string{"option", "description", ""}, false},
+		{"option lat 49.45 # centre", []string{"option", "lat", "49.45"}, false},
+		{"option comment '# not a comment'", []string{"option", "comment", "# not a comment"}, false},
+		{"option lat '49.45", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := uciFields(tt.line)
+		if (err != nil) != tt.err {
+			t.Errorf("uciFields(%q) error = %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("uciFields(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigMergeGatewayJSON(t *testing.T) {
+	fromFile, err := configFromFile("gateway.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fromHostname := newConfigSource("os.Hostname")
+	fromHostname.config.Hostname = "node1"
+	fromHostname.set["Hostname"] = true
+
+	c, origins := configMerge(fromFile, fromHostname)
+
+	if c.Hostname != "node1" || origins["Hostname"] != "os.Hostname" {
+		t.Errorf("Hostname = %q from %q, want %q from os.Hostname", c.Hostname, origins["Hostname"], "node1")
+	}
+	if c.Contact != "me@example.com" || origins["Contact"] != "file" {
+		t.Errorf("Contact = %q from %q, want %q from file", c.Contact, origins["Contact"], "me@example.com")
+	}
+	if c.Lat != 1 || origins["Lat"] != "file" {
+		t.Errorf("Lat = %v from %q, want 1 from file", c.Lat, origins["Lat"])
+	}
+}
+
+// testConfigFromCmd parses args with a fresh flag set, configFromCmd defines
+// its flags on flag.CommandLine
+func testConfigFromCmd(t *testing.T, args ...string) configSource {
+	t.Helper()
+	saved := flag.CommandLine
+	t.Cleanup(func() { flag.CommandLine = saved })
+	flag.CommandLine = flag.NewFlagSet("gnw", flag.ContinueOnError)
+	return configFromCmd(args)
+}
+
+func TestConfigMergeZeroValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gnw.json")
+	err := os.WriteFile(path, []byte(`{"RenameClientIf": true, "Lat": 49.45, "Lng": 11.07, "Description": ""}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromFile, err := configFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromCmd := testConfigFromCmd(t, "-renameclientif=false", "-lat", "0")
+
+	fromDefaults := newConfigSource("default")
+	fromDefaults.config.Description = "default"
+	fromDefaults.set["Description"] = true
+
+	c, origins := configMerge(fromCmd, fromFile, fromDefaults)
+
+	if c.RenameClientIf || origins["RenameClientIf"] != "flag" {
+		t.Errorf("RenameClientIf = %v from %q, want false from flag", c.RenameClientIf, origins["RenameClientIf"])
+	}
+	if c.Lat != 0 || origins["Lat"] != "flag" {
+		t.Errorf("Lat = %v from %q, want 0 from flag", c.Lat, origins["Lat"])
+	}
+	if c.Lng != 11.07 || origins["Lng"] != "file" {
+		t.Errorf("Lng = %v from %q, want 11.07 from file", c.Lng, origins["Lng"])
+	}
+	// an empty string is a value like any other
+	if c.Description != "" || origins["Description"] != "file" {
+		t.Errorf("Description = %q from %q, want empty from file", c.Description, origins["Description"])
+	}
+}
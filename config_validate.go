@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	dnsLabel = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
+	phone    = regexp.MustCompile(`^\+?[0-9][0-9 ()/.-]{4,}$`)
+	// a phone number needs enough digits and at least one longer block of them
+	phoneDigits = regexp.MustCompile(`[0-9]{3}`)
+)
+
+func validPhone(contact string) bool {
+	if !phone.MatchString(contact) || !phoneDigits.MatchString(contact) {
+		return false
+	}
+	digits := 0
+	for _, r := range contact {
+		if r >= '0' && r <= '9' {
+			digits++
+		}
+	}
+	return digits >= 6
+}
+
+func validEmail(contact string) bool {
+	_, err := mail.ParseAddress(contact)
+	return err == nil
+}
+
+// validContactURL accepts the URL schemes that can reach a person
+func validContactURL(contact string) bool {
+	u, err := url.Parse(contact)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return u.Host != ""
+	case "mailto", "xmpp", "sip":
+		return validEmail(u.Opaque)
+	case "tel":
+		return validPhone(u.Opaque)
+	}
+	return false
+}
+
+func validContact(contact string) bool {
+	return validEmail(contact) || validContactURL(contact) || validPhone(contact)
+}
+
+// knownHoods splits the comma separated Hoods option
+func knownHoods(c Config) []string {
+	var hoods []string
+	for _, h := range strings.Split(c.Hoods, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			hoods = append(hoods, h)
+		}
+	}
+	return hoods
+}
+
+func validateHood(c Config) error {
+	hoods := knownHoods(c)
+	if len(hoods) == 0 {
+		return nil
+	}
+	for _, h := range hoods {
+		if h == c.Hood {
+			return nil
+		}
+	}
+	for _, h := range hoods {
+		if strings.EqualFold(h, c.Hood) {
+			return fmt.Errorf("unknown hood %q, did you mean %q?", c.Hood, h)
+		}
+	}
+	return fmt.Errorf("unknown hood %q, expected one of %s", c.Hood, strings.Join(hoods, ", "))
+}
+
+// configValidate checks the values of all present options. Missing options are
+// reported by configRequire.
+func configValidate(errors errors, c Config, origins map[string]string) errors {
+	if origins["Lat"] != "" && (c.Lat < -90 || c.Lat > 90) {
+		errors = append(errors, fmt.Errorf("latitude %v out of range [-90, 90]", c.Lat))
+	}
+	if origins["Lng"] != "" && (c.Lng < -180 || c.Lng > 180) {
+		errors = append(errors, fmt.Errorf("longitude %v out of range [-180, 180]", c.Lng))
+	}
+	// shipped with the example gateway.json
+	if c.Lat == 1 && c.Lng == 1 {
+		errors = append(errors, fmt.Errorf("position 1/1 is a placeholder, set Lat and Lng to the position of the node"))
+	}
+	if c.Hostname != "" && !dnsLabel.MatchString(c.Hostname) {
+		errors = append(errors, fmt.Errorf("hostname %q is not a valid DNS label", c.Hostname))
+	}
+	if c.Contact != "" && !validContact(c.Contact) {
+		errors = append(errors, fmt.Errorf("contact %q is neither an e-mail address, URL nor phone number", c.Contact))
+	}
+	if c.Hood != "" {
+		if err := validateHood(c); err != nil {
+			errors = append(errors, err)
+		}
+	}
+	if _, _, err := discoverModes(c); err != nil {
+		errors = append(errors, err)
+	}
+	if c.Proxy != "" {
+		if _, err := proxyURL(c.Proxy); err != nil {
+			errors = append(errors, err)
+		}
+	}
+	if keys, err := forwarderKeys(c); err != nil {
+		errors = append(errors, err)
+	} else if c.Listen != "" && len(keys) == 0 {
+		errors = append(errors, fmt.Errorf("option \"ForwarderKeys\" is required with Listen"))
+	}
+	switch c.Compression {
+	case "", "gzip", "zstd":
+	default:
+		errors = append(errors, fmt.Errorf("unknown compression %q, expected gzip or zstd", c.Compression))
+	}
+	switch c.LogFormat {
+	case "", logfmt, logJSON:
+	default:
+		errors = append(errors, fmt.Errorf("unknown log format %q, expected logfmt or json", c.LogFormat))
+	}
+	if c.ClientEvents != "" && c.ClientEvents != "log" {
+		if u, err := url.Parse(c.ClientEvents); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errors = append(errors, fmt.Errorf("client events %q is neither \"log\" nor a http(s) URL", c.ClientEvents))
+		}
+	}
+	return errors
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestValidContact(t *testing.T) {
+	tests := []struct {
+		contact string
+		want    bool
+	}{
+		{"me@example.com", true},
+		{"Jane Doe <jane@example.com>", true},
+		{"https://example.com/contact", true},
+		{"http://example.com", true},
+		{"mailto:me@example.com", true},
+		{"MAILTO:me@example.com", true},
+		{"xmpp:me@jabber.example.com", true},
+		{"tel:+49911123456", true},
+		{"+49 911 123456", true},
+		{"0911 / 123456", true},
+		{"0911 12-34-56", true},
+
+		{"", false},
+		{"todo: fill in", false},
+		{"Contact: none yet", false},
+		{"x:y", false},
+		{"ftp://example.com", false},
+		{"https://", false},
+		{"mailto:nobody", false},
+		{"tel:123", false},
+		{"1/1/1/1/1", false},
+		{"1/1/1/1/1/1", false},
+		{"12345", false},
+		{"me", false},
+	}
+	for _, tt := range tests {
+		if got := validContact(tt.contact); got != tt.want {
+			t.Errorf("validContact(%q) = %v, want %v", tt.contact, got, tt.want)
+		}
+	}
+}
+
+func TestConfigValidateCompression(t *testing.T) {
+	for _, compression := range []string{"", "gzip", "zstd"} {
+		if errs := configValidate(nil, Config{Compression: compression}, nil); len(errs) != 0 {
+			t.Errorf("compression %q: %v", compression, errs)
+		}
+	}
+	if errs := configValidate(nil, Config{Compression: "gz"}, nil); len(errs) != 1 {
+		t.Errorf("compression \"gz\": %v, want one error", errs)
+	}
+}
+
+func TestConfigValidateListen(t *testing.T) {
+	// base64 of 32 zero bytes
+	key := "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="
+	tests := []struct {
+		c    Config
+		errs int
+	}{
+		{Config{}, 0},
+		{Config{DropDir: "/tmp/gnw"}, 0},
+		{Config{Listen: ":8080"}, 1},
+		{Config{Listen: ":8080", ForwarderKeys: key}, 0},
+		{Config{Listen: ":8080", ForwarderKeys: "AAAA"}, 1},
+	}
+	for _, tt := range tests {
+		if errs := configValidate(nil, tt.c, nil); len(errs) != tt.errs {
+			t.Errorf("listen %q, keys %q: %v, want %d errors", tt.c.Listen, tt.c.ForwarderKeys, errs, tt.errs)
+		}
+	}
+}
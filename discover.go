@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/bpf"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+	"golang.org/x/sys/unix"
+)
+
+// ICMPv6 types of the replies to active discovery probes
+const (
+	icmpTypeEchoReply    = 129
+	icmpTypeMLDQuery     = 130
+	icmpTypeMLDReport    = 131
+	icmpTypeMLDv2Report  = 143
+	ipv6HeaderLen        = 40
+	ipProtoHopByHop      = 0
+	ipProtoICMPv6        = 58
+	mldMaxResponseMillis = 1000
+)
+
+var allNodes = netip.MustParseAddr("ff02::1")
+
+// discoverer actively probes for clients with multicast ICMPv6 echo requests
+// and MLD queries and records the hardware addresses of all responders. Probes
+// are sent by start, so replies are buffered while other probing runs.
+type discoverer struct {
+	fd      int
+	iface   net.Interface
+	started time.Time
+}
+
+// discoverModes parses the Discover option
+func discoverModes(c Config) (echo, mld bool, err error) {
+	for _, mode := range strings.Split(c.Discover, ",") {
+		switch strings.TrimSpace(mode) {
+		case "":
+		case "echo":
+			echo = true
+		case "mld":
+			mld = true
+		default:
+			return false, false, fmt.Errorf("unknown discovery mode %q", mode)
+		}
+	}
+	return echo, mld, nil
+}
+
+// startDiscovery opens a packet socket on iface and sends the configured
+// probes. src is the link-local address used for MLD queries.
+func startDiscovery(c Config, n ndp, iface net.Interface, src netip.Addr) (*discoverer, error) {
+	echo, mld, err := discoverModes(c)
+	if err != nil || !(echo || mld) {
+		return nil, err
+	}
+
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, int(htons(unix.ETH_P_IPV6)))
+	if err != nil {
+		return nil, err
+	}
+	if err := attachFilter(fd, discoveryFilter); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	if err := unix.Bind(fd, &unix.SockaddrLinklayer{
+		Protocol: htons(unix.ETH_P_IPV6),
+		Ifindex:  iface.Index,
+	}); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	d := &discoverer{fd: fd, iface: iface, started: time.Now()}
+
+	if echo {
+		if err := n.echoAllNodes(iface); err != nil {
+			d.Close()
+			return nil, err
+		}
+	}
+	if mld && src.IsLinkLocalUnicast() {
+		if err := d.mldQuery(src); err != nil {
+			d.Close()
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// discoveryFilter passes the packets accepted by isDiscoveryReply to the
+// socket, so the kernel drops all other IPv6 traffic on the interface. Packet
+// sockets of type SOCK_DGRAM start at the IPv6 header.
+var discoveryFilter = []bpf.Instruction{
+	bpf.LoadConstant{Dst: bpf.RegX, Val: 0},
+	bpf.LoadAbsolute{Off: 6, Size: 1},
+	bpf.JumpIf{Cond: bpf.JumpEqual, Val: ipProtoICMPv6, SkipTrue: 7},
+	bpf.JumpIf{Cond: bpf.JumpEqual, Val: ipProtoHopByHop, SkipFalse: 10},
+	// MLD reports carry a hop-by-hop header, X = its length
+	bpf.LoadAbsolute{Off: ipv6HeaderLen, Size: 1},
+	bpf.JumpIf{Cond: bpf.JumpEqual, Val: ipProtoICMPv6, SkipFalse: 8},
+	bpf.LoadAbsolute{Off: ipv6HeaderLen + 1, Size: 1},
+	bpf.ALUOpConstant{Op: bpf.ALUOpAdd, Val: 1},
+	bpf.ALUOpConstant{Op: bpf.ALUOpShiftLeft, Val: 3},
+	bpf.TAX{},
+	// ICMPv6 type
+	bpf.LoadIndirect{Off: ipv6HeaderLen, Size: 1},
+	bpf.JumpIf{Cond: bpf.JumpEqual, Val: icmpTypeEchoReply, SkipTrue: 3},
+	bpf.JumpIf{Cond: bpf.JumpEqual, Val: icmpTypeMLDReport, SkipTrue: 2},
+	bpf.JumpIf{Cond: bpf.JumpEqual, Val: icmpTypeMLDv2Report, SkipTrue: 1},
+	bpf.RetConstant{Val: 0},
+	bpf.RetConstant{Val: 1 << 18},
+}
+
+// attachFilter attaches a classic BPF program to the socket
+func attachFilter(fd int, filter []bpf.Instruction) error {
+	raw, err := bpf.Assemble(filter)
+	if err != nil {
+		return err
+	}
+	prog := make([]unix.SockFilter, len(raw))
+	for i, ins := range raw {
+		prog[i] = unix.SockFilter{Code: ins.Op, Jt: ins.Jt, Jf: ins.Jf, K: ins.K}
+	}
+	return unix.SetsockoptSockFprog(fd, unix.SOL_SOCKET, unix.SO_ATTACH_FILTER, &unix.SockFprog{
+		Len:    uint16(len(prog)),
+		Filter: &prog[0],
+	})
+}
+
+func (d *discoverer) Close() error {
+	return unix.Close(d.fd)
+}
+
+// echoAllNodes sends an ICMPv6 echo request to all nodes on iface
+func (n ndp) echoAllNodes(iface net.Interface) error {
+	m := icmp.Message{
+		Type: ipv6.ICMPTypeEchoRequest,
+		Body: &icmp.Echo{
+			ID:   os.Getpid() & 0xffff,
+			Seq:  1,
+			Data: []byte("gnw"),
+		},
+	}
+	b, err := m.Marshal(nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = n.p.WriteTo(b, nil, &net.IPAddr{
+		IP:   allNodes.AsSlice(),
+		Zone: iface.Name,
+	})
+	return err
+}
+
+func icmpv6Checksum(src, dst netip.Addr, msg []byte) uint16 {
+	var sum uint32
+	add := func(b []byte) {
+		for i := 0; i+1 < len(b); i += 2 {
+			sum += uint32(binary.BigEndian.Uint16(b[i:]))
+		}
+		if len(b)%2 == 1 {
+			sum += uint32(b[len(b)-1]) << 8
+		}
+	}
+
+	s, t := src.As16(), dst.As16()
+	add(s[:])
+	add(t[:])
+	var l [8]byte
+	binary.BigEndian.PutUint32(l[0:], uint32(len(msg)))
+	l[7] = ipProtoICMPv6
+	add(l[:])
+	add(msg)
+
+	for sum > 0xffff {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+// mldQuery sends an MLDv2 general query. The packet is built by hand, as the
+// query requires a router alert hop-by-hop option. Note that the query takes
+// part in the querier election, if there is no other querier with a lower
+// address.
+func (d *discoverer) mldQuery(src netip.Addr) error {
+	query := make([]byte, 28)
+	query[0] = icmpTypeMLDQuery
+	binary.BigEndian.PutUint16(query[4:], mldMaxResponseMillis)
+	query[24] = 2   // QRV
+	query[25] = 125 // QQIC
+	binary.BigEndian.PutUint16(query[2:], icmpv6Checksum(src, allNodes, query))
+
+	hbh := []byte{
+		ipProtoICMPv6, 0,
+		5, 2, 0, 0, // router alert: MLD
+		1, 0, // PadN
+	}
+
+	pkt := make([]byte, ipv6HeaderLen, ipv6HeaderLen+len(hbh)+len(query))
+	pkt[0] = 6 << 4
+	binary.BigEndian.PutUint16(pkt[4:], uint16(len(hbh)+len(query)))
+	pkt[6] = ipProtoHopByHop
+	pkt[7] = 1 // hop limit
+	s, t := src.As16(), allNodes.As16()
+	copy(pkt[8:], s[:])
+	copy(pkt[24:], t[:])
+	pkt = append(pkt, hbh...)
+	pkt = append(pkt, query...)
+
+	return unix.Sendto(d.fd, pkt, 0, &unix.SockaddrLinklayer{
+		Protocol: htons(unix.ETH_P_IPV6),
+		Ifindex:  d.iface.Index,
+		Halen:    6,
+		Addr:     [8]byte{0x33, 0x33, 0, 0, 0, 1},
+	})
+}
+
+// isDiscoveryReply reports if the IPv6 packet is an echo reply or MLD report
+func isDiscoveryReply(b []byte) bool {
+	if len(b) < ipv6HeaderLen || b[0]>>4 != 6 {
+		return false
+	}
+	next := b[6]
+	b = b[ipv6HeaderLen:]
+	if next == ipProtoHopByHop {
+		if len(b) < 8 || len(b) < (int(b[1])+1)*8 {
+			return false
+		}
+		next = b[0]
+		b = b[(int(b[1])+1)*8:]
+	}
+	if next != ipProtoICMPv6 || len(b) < 4 {
+		return false
+	}
+	switch b[0] {
+	case icmpTypeEchoReply, icmpTypeMLDReport, icmpTypeMLDv2Report:
+		return true
+	}
+	return false
+}
+
+// collect returns the hardware addresses of all responders until timeout has
+// passed since the probes were sent
+func (d *discoverer) collect(timeout time.Duration) ([]net.HardwareAddr, error) {
+	seen := map[string]net.HardwareAddr{}
+	buf := make([]byte, 1500)
+	if d.iface.MTU > len(buf) {
+		buf = make([]byte, d.iface.MTU)
+	}
+	deadline := d.started.Add(timeout)
+
+	for {
+		// drain buffered packets even if the deadline has already passed
+		remaining := time.Until(deadline)
+		if remaining < 0 {
+			remaining = 0
+		}
+
+		fds := []unix.PollFd{{Fd: int32(d.fd), Events: unix.POLLIN}}
+		n, err := unix.Poll(fds, int(remaining/time.Millisecond))
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			break
+		}
+
+		c, from, err := unix.Recvfrom(d.fd, buf, unix.MSG_DONTWAIT)
+		if err == unix.EAGAIN || err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		ll, ok := from.(*unix.SockaddrLinklayer)
+		if !ok || ll.Pkttype == unix.PACKET_OUTGOING || ll.Halen != 6 {
+			continue
+		}
+		// packets queued before the filter was attached
+		if !isDiscoveryReply(buf[:c]) {
+			continue
+		}
+
+		mac := net.HardwareAddr(append([]byte(nil), ll.Addr[:6]...))
+		seen[mac.String()] = mac
+	}
+
+	macs := make([]net.HardwareAddr, 0, len(seen))
+	for _, mac := range seen {
+		macs = append(macs, mac)
+	}
+	return macs, nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"testing"
+
+	"golang.org/x/net/bpf"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+	"golang.org/x/sys/unix"
+)
+
+// ipv6Packet prepends an IPv6 header and the extension headers to msg
+func ipv6Packet(next byte, ext []byte, msg []byte) []byte {
+	pkt := make([]byte, ipv6HeaderLen, ipv6HeaderLen+len(ext)+len(msg))
+	pkt[0] = 6 << 4
+	binary.BigEndian.PutUint16(pkt[4:], uint16(len(ext)+len(msg)))
+	pkt[6] = next
+	pkt[7] = 1
+	pkt = append(pkt, ext...)
+	return append(pkt, msg...)
+}
+
+func TestIsDiscoveryReply(t *testing.T) {
+	hbh := []byte{ipProtoICMPv6, 0, 5, 2, 0, 0, 1, 0}
+	// a hop-by-hop header of 16 bytes
+	longHBH := []byte{ipProtoICMPv6, 1, 5, 2, 0, 0, 1, 8, 0, 0, 0, 0, 0, 0, 0, 0}
+	icmpMsg := func(typ byte) []byte { return []byte{typ, 0, 0, 0, 0, 0, 0, 0} }
+
+	tests := []struct {
+		name string
+		pkt  []byte
+		want bool
+	}{
+		{"echo reply", ipv6Packet(ipProtoICMPv6, nil, icmpMsg(icmpTypeEchoReply)), true},
+		{"mld report", ipv6Packet(ipProtoHopByHop, hbh, icmpMsg(icmpTypeMLDReport)), true},
+		{"mldv2 report", ipv6Packet(ipProtoHopByHop, hbh, icmpMsg(icmpTypeMLDv2Report)), true},
+		{"long hop-by-hop", ipv6Packet(ipProtoHopByHop, longHBH, icmpMsg(icmpTypeMLDv2Report)), true},
+		{"echo request", ipv6Packet(ipProtoICMPv6, nil, icmpMsg(128)), false},
+		{"mld query", ipv6Packet(ipProtoHopByHop, hbh, icmpMsg(icmpTypeMLDQuery)), false},
+		{"neighbor advertisement", ipv6Packet(ipProtoICMPv6, nil, icmpMsg(136)), false},
+		{"udp", ipv6Packet(17, nil, icmpMsg(icmpTypeEchoReply)), false},
+		{"hop-by-hop to udp", ipv6Packet(ipProtoHopByHop, []byte{17, 0, 5, 2, 0, 0, 1, 0}, icmpMsg(icmpTypeEchoReply)), false},
+		{"truncated hop-by-hop", ipv6Packet(ipProtoHopByHop, longHBH[:8], nil), false},
+		{"truncated icmp", ipv6Packet(ipProtoICMPv6, nil, nil), false},
+		{"short", make([]byte, 20), false},
+	}
+
+	vm, err := bpf.NewVM(discoveryFilter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		if got := isDiscoveryReply(tt.pkt); got != tt.want {
+			t.Errorf("%s: isDiscoveryReply() = %v, want %v", tt.name, got, tt.want)
+		}
+		n, err := vm.Run(tt.pkt)
+		if err != nil {
+			t.Errorf("%s: filter: %v", tt.name, err)
+		}
+		if got := n > 0; got != tt.want {
+			t.Errorf("%s: filter accepted %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := bpf.Assemble(discoveryFilter); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestICMPv6Checksum(t *testing.T) {
+	src := netip.MustParseAddr("fe80::1")
+	dst := netip.MustParseAddr("ff02::1")
+
+	m := icmp.Message{
+		Type: ipv6.ICMPTypeEchoRequest,
+		Body: &icmp.Echo{ID: 1, Seq: 1, Data: []byte("gnw")},
+	}
+	// odd length, icmp computes the checksum with the pseudo header
+	want, err := m.Marshal(icmp.IPv6PseudoHeader(src.AsSlice(), dst.AsSlice()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := append([]byte(nil), want...)
+	msg[2], msg[3] = 0, 0
+
+	if got := icmpv6Checksum(src, dst, msg); got != binary.BigEndian.Uint16(want[2:]) {
+		t.Errorf("icmpv6Checksum() = %#04x, want %#04x", got, binary.BigEndian.Uint16(want[2:]))
+	}
+	// a message with a valid checksum sums up to zero
+	if got := icmpv6Checksum(src, dst, want); got != 0 {
+		t.Errorf("icmpv6Checksum() over a checksummed message = %#04x, want 0", got)
+	}
+}
+
+func TestDiscoverModes(t *testing.T) {
+	tests := []struct {
+		discover  string
+		echo, mld bool
+		err       bool
+	}{
+		{"", false, false, false},
+		{"echo", true, false, false},
+		{"mld", false, true, false},
+		{"echo, mld", true, true, false},
+		{"mld,", false, true, false},
+		{"ping", false, false, true},
+	}
+	for _, tt := range tests {
+		echo, mld, err := discoverModes(Config{Discover: tt.discover})
+		if echo != tt.echo || mld != tt.mld || (err != nil) != tt.err {
+			t.Errorf("discoverModes(%q) = %v, %v, %v", tt.discover, echo, mld, err)
+		}
+	}
+}
+
+func TestAttachFilter(t *testing.T) {
+	// packet sockets need CAP_NET_RAW, the filter works the same on any socket
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_DGRAM, 0)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer unix.Close(fds[0])
+	defer unix.Close(fds[1])
+
+	if err := attachFilter(fds[0], discoveryFilter); err != nil {
+		t.Fatal(err)
+	}
+
+	request := ipv6Packet(ipProtoICMPv6, nil, []byte{128, 0, 0, 0})
+	reply := ipv6Packet(ipProtoICMPv6, nil, []byte{icmpTypeEchoReply, 0, 0, 0})
+	for _, pkt := range [][]byte{request, reply} {
+		if err := unix.Send(fds[1], pkt, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf := make([]byte, 100)
+	n, _, err := unix.Recvfrom(fds[0], buf, unix.MSG_DONTWAIT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf[ipv6HeaderLen] != icmpTypeEchoReply || n != len(reply) {
+		t.Errorf("received % x, want the echo reply", buf[:n])
+	}
+	if _, _, err := unix.Recvfrom(fds[0], buf, unix.MSG_DONTWAIT); err != unix.EAGAIN {
+		t.Errorf("second receive: %v, want EAGAIN", err)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// client counting methods
+const (
+	countNeigh = "neigh"
+	countFDB   = "fdb"
+)
+
+// countMethods parses the CountMethods option, e.g. "br-client=fdb,eth1=neigh"
+func countMethods(c Config) (map[string]string, error) {
+	methods := map[string]string{}
+	for _, m := range strings.Split(c.CountMethods, ",") {
+		m = strings.TrimSpace(m)
+		if m == "" {
+			continue
+		}
+		kv := strings.SplitN(m, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid count method %q, expected interface=method", m)
+		}
+		switch kv[1] {
+		case countNeigh, countFDB:
+		default:
+			return nil, fmt.Errorf("unknown count method %q for %s", kv[1], kv[0])
+		}
+		methods[kv[0]] = kv[1]
+	}
+	return methods, nil
+}
+
+// countMethod returns the method to count clients on ifname, defaulting to the
+// neighbour table. The option is parsed by getConfig.
+func countMethod(c Config, ifname string) string {
+	if m, ok := c.CountBy[ifname]; ok {
+		return m
+	}
+	return countNeigh
+}
+
+func matchAny(patterns, name string) bool {
+	for _, pattern := range strings.Split(patterns, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// fdbStation reports whether the forwarding database entry is a station the
+// bridge learned on one of its ports. Local and static entries and multicast
+// addresses are skipped.
+func fdbStation(e netlink.Neigh, brIndex int) bool {
+	if e.MasterIndex != brIndex || e.LinkIndex == brIndex {
+		return false
+	}
+	// entries of the port's own driver, not learned by the bridge
+	if e.Flags&netlink.NTF_SELF != 0 {
+		return false
+	}
+	if e.State&(netlink.NUD_PERMANENT|netlink.NUD_NOARP) != 0 {
+		return false
+	}
+	return len(e.HardwareAddr) != 0 && e.HardwareAddr[0]&0x01 == 0
+}
+
+// fdbClients returns the distinct stations learned in the forwarding database
+// of the bridge, see fdbStation. Entries on ports matching FdbIgnorePorts are
+// skipped.
+func fdbClients(c Config, nlhandle *netlink.Handle, bridge netlink.Link) ([]net.HardwareAddr, error) {
+	if bridge.Type() != "bridge" {
+		return nil, fmt.Errorf("%s is not a bridge", bridge.Attrs().Name)
+	}
+	brIndex := bridge.Attrs().Index
+
+	entries, err := nlhandle.NeighList(0, unix.AF_BRIDGE)
+	if err != nil {
+		return nil, err
+	}
+
+	ignored := map[int]bool{}
+	seen := map[string]net.HardwareAddr{}
+	for _, e := range entries {
+		if !fdbStation(e, brIndex) {
+			continue
+		}
+
+		ignore, ok := ignored[e.LinkIndex]
+		if !ok {
+			if port, err := nlhandle.LinkByIndex(e.LinkIndex); err == nil {
+				ignore = matchAny(c.FdbIgnorePorts, port.Attrs().Name)
+			}
+			ignored[e.LinkIndex] = ignore
+		}
+		if ignore {
+			continue
+		}
+
+		seen[e.HardwareAddr.String()] = e.HardwareAddr
+	}
+
+	macs := make([]net.HardwareAddr, 0, len(seen))
+	for _, mac := range seen {
+		macs = append(macs, mac)
+	}
+	return macs, nil
+}
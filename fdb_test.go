@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func TestCountMethods(t *testing.T) {
+	tests := []struct {
+		option string
+		want   map[string]string
+		err    bool
+	}{
+		{"", map[string]string{}, false},
+		{"br-client=fdb", map[string]string{"br-client": countFDB}, false},
+		{" br-client=fdb, eth1=neigh ,", map[string]string{"br-client": countFDB, "eth1": countNeigh}, false},
+		{"br-client", nil, true},
+		{"br-client=arp", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := countMethods(Config{CountMethods: tt.option})
+		if (err != nil) != tt.err || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("countMethods(%q) = %v, %v", tt.option, got, err)
+		}
+	}
+
+	c := Config{CountBy: map[string]string{"br-client": countFDB}}
+	if m := countMethod(c, "br-client"); m != countFDB {
+		t.Errorf("countMethod(br-client) = %q", m)
+	}
+	if m := countMethod(c, "eth1"); m != countNeigh {
+		t.Errorf("countMethod(eth1) = %q", m)
+	}
+}
+
+func TestMatchAny(t *testing.T) {
+	tests := []struct {
+		patterns, name string
+		want           bool
+	}{
+		{"bat*,vx*", "bat0", true},
+		{"bat*, vx*", "vx-mesh", true},
+		{"bat*,vx*", "eth0", false},
+		{"", "eth0", false},
+		{"eth0", "eth0", true},
+	}
+	for _, tt := range tests {
+		if got := matchAny(tt.patterns, tt.name); got != tt.want {
+			t.Errorf("matchAny(%q, %q) = %v, want %v", tt.patterns, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFdbStation(t *testing.T) {
+	const bridge, port = 5, 6
+	mac := net.HardwareAddr{0x02, 0, 0, 0, 0, 1}
+	station := netlink.Neigh{LinkIndex: port, MasterIndex: bridge, State: netlink.NUD_REACHABLE, HardwareAddr: mac}
+
+	tests := []struct {
+		name string
+		edit func(e *netlink.Neigh)
+		want bool
+	}{
+		{"learned", func(e *netlink.Neigh) {}, true},
+		{"stale", func(e *netlink.Neigh) { e.State = netlink.NUD_STALE }, true},
+		{"other bridge", func(e *netlink.Neigh) { e.MasterIndex = 7 }, false},
+		{"bridge itself", func(e *netlink.Neigh) { e.LinkIndex = bridge }, false},
+		{"port driver", func(e *netlink.Neigh) { e.Flags = netlink.NTF_SELF }, false},
+		{"local", func(e *netlink.Neigh) { e.State = netlink.NUD_PERMANENT }, false},
+		{"static", func(e *netlink.Neigh) { e.State = netlink.NUD_NOARP }, false},
+		{"multicast", func(e *netlink.Neigh) { e.HardwareAddr = net.HardwareAddr{0x33, 0x33, 0, 0, 0, 1} }, false},
+		{"no address", func(e *netlink.Neigh) { e.HardwareAddr = nil }, false},
+	}
+	for _, tt := range tests {
+		e := station
+		tt.edit(&e)
+		if got := fdbStation(e, bridge); got != tt.want {
+			t.Errorf("%s: fdbStation() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/prometheus/procfs"
+	"github.com/prometheus/procfs/sysfs"
+)
+
+// hostFS provides all access to procfs and sysfs below the configured mount
+// points, so that a host can be monitored from inside a container and
+// collectors can be run against fixture directories
+type hostFS struct {
+	proc     procfs.FS
+	sys      sysfs.FS
+	procRoot string
+	sysRoot  string
+}
+
+func newHostFS(c Config) (hostFS, error) {
+	proc, err := procfs.NewFS(c.ProcRoot)
+	if err != nil {
+		return hostFS{}, err
+	}
+	sys, err := sysfs.NewFS(c.SysRoot)
+	if err != nil {
+		return hostFS{}, err
+	}
+
+	return hostFS{
+		proc:     proc,
+		sys:      sys,
+		procRoot: c.ProcRoot,
+		sysRoot:  c.SysRoot,
+	}, nil
+}
+
+// procPath returns the path of a file below the procfs mount point
+func (fs hostFS) procPath(elem ...string) string {
+	return filepath.Join(append([]string{fs.procRoot}, elem...)...)
+}
+
+// sysPath returns the path of a file below the sysfs mount point
+func (fs hostFS) sysPath(elem ...string) string {
+	return filepath.Join(append([]string{fs.sysRoot}, elem...)...)
+}
+
+// kb dereferences optional procfs values, which are missing on some kernels
+func kb(v *uint64) int {
+	if v == nil {
+		return 0
+	}
+	return int(*v)
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// fixtureFS returns a hostFS for the proc and sys directories of a fixture
+// below testdata
+func fixtureFS(t *testing.T, name string) hostFS {
+	t.Helper()
+	fs, err := newHostFS(Config{
+		ProcRoot: filepath.Join("testdata", name, "proc"),
+		SysRoot:  filepath.Join("testdata", name, "sys"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
@@ -1,14 +1,22 @@
 module github.com/lemmi/gnw
 
-go 1.15
+go 1.22
 
 require (
-	github.com/hashicorp/errwrap v1.1.0 // indirect
+	github.com/BurntSushi/toml v1.2.1
 	github.com/hashicorp/go-multierror v1.1.1
+	github.com/klauspost/compress v1.18.0
 	github.com/lemmi/closer v0.0.1
 	github.com/prometheus/procfs v0.8.0
 	github.com/vishvananda/netlink v1.1.0
-	github.com/vishvananda/netns v0.0.0-20220913150850-18c4f4234207 // indirect
 	golang.org/x/net v0.0.0-20220930213112-107f3e3c3b0b
 	golang.org/x/sys v0.0.0-20220928140112-f11e5e49a4ec
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/hashicorp/errwrap v1.1.0 // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+	github.com/vishvananda/netns v0.0.0-20220913150850-18c4f4234207 // indirect
+	golang.org/x/sync v0.0.0-20220601150217-0de741cfad7f // indirect
 )
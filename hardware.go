@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lemmi/closer"
+	"github.com/prometheus/procfs/sysfs"
+)
+
+type hardware struct {
+	cpu     []string
+	chipset string
+	model   string
+}
+
+// readSysValue returns the first line or NUL terminated string of a sysfs
+// file, or an empty string if it can't be read
+func readSysValue(path string) string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	if i := bytes.IndexAny(b, "\x00\n"); i >= 0 {
+		b = b[:i]
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// readCpuinfo returns the cpu model of every processor, the number of
+// processors and the values of the first occurrence of all other keys
+func readCpuinfo(path string) (cpus []string, processors int, info map[string]string, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	defer closer.Do(f)
+
+	info = map[string]string{}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key := strings.TrimSpace(kv[0])
+		value := strings.TrimSpace(kv[1])
+
+		switch key {
+		case "processor":
+			processors++
+		case "model name", "cpu model":
+			cpus = append(cpus, value)
+		}
+		if _, ok := info[key]; !ok {
+			info[key] = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, nil, err
+	}
+
+	// some architectures only name the cpu once
+	for len(cpus) > 0 && len(cpus) < processors {
+		cpus = append(cpus, cpus[0])
+	}
+
+	return cpus, processors, info, nil
+}
+
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func str(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return strings.TrimSpace(*s)
+}
+
+func joinNonEmpty(values ...string) string {
+	var ret []string
+	for _, v := range values {
+		if v != "" {
+			ret = append(ret, v)
+		}
+	}
+	return strings.Join(ret, " ")
+}
+
+// readHardware collects the cpu, chipset and model from procfs, the device tree
+// and DMI data
+func readHardware(fs hostFS) (hardware, error) {
+	var hw hardware
+
+	cpus, processors, info, err := readCpuinfo(fs.procPath("cpuinfo"))
+	if err != nil {
+		return hw, err
+	}
+
+	dt := fs.sysPath("firmware/devicetree/base")
+
+	// DMI data is only available on x86
+	dmi, err := fs.sys.DMIClass()
+	if err != nil {
+		dmi = &sysfs.DMIClass{}
+	}
+
+	// the last compatible string of the device tree root names the SoC
+	var soc string
+	if b, err := os.ReadFile(filepath.Join(dt, "compatible")); err == nil {
+		compatible := strings.Split(strings.TrimRight(string(b), "\x00"), "\x00")
+		soc = compatible[len(compatible)-1]
+	}
+
+	hw.cpu = cpus
+	if len(hw.cpu) == 0 {
+		// fall back to the processor name given once for all processors,
+		// cpuinfo describes the host of the mounted procfs, not this binary
+		if cpu := firstOf(info["Processor"], info["cpu"], info["CPU architecture"]); cpu != "" {
+			for i := 0; i < max(processors, 1); i++ {
+				hw.cpu = append(hw.cpu, cpu)
+			}
+		}
+	}
+	hw.chipset = firstOf(
+		info["Hardware"],
+		info["system type"],
+		soc,
+		joinNonEmpty(str(dmi.BoardVendor), str(dmi.BoardName)),
+	)
+	hw.model = firstOf(
+		readSysValue(filepath.Join(dt, "model")),
+		info["machine"],
+		joinNonEmpty(str(dmi.SystemVendor), str(dmi.ProductName)),
+		info["Model"],
+	)
+
+	return hw, nil
+}
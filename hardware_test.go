@@ -0,0 +1,83 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadHardware(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    hardware
+	}{
+		{"openwrt", hardware{
+			cpu:     []string{"MIPS 74Kc V5.0"},
+			chipset: "Qualcomm Atheros QCA9563 ver 1 rev 0",
+			model:   "TP-Link Archer C7 v5",
+		}},
+		{"x86", hardware{
+			cpu: []string{
+				"Intel(R) Core(TM) i5-8250U CPU @ 1.60GHz",
+				"Intel(R) Core(TM) i5-8250U CPU @ 1.60GHz",
+			},
+			chipset: "LENOVO 20KH006MGE",
+			model:   "LENOVO ThinkPad X1 Carbon 6th",
+		}},
+		// the processor is only named once
+		{"rpi2", hardware{
+			cpu: []string{
+				"ARMv7 Processor rev 5 (v7l)",
+				"ARMv7 Processor rev 5 (v7l)",
+				"ARMv7 Processor rev 5 (v7l)",
+				"ARMv7 Processor rev 5 (v7l)",
+			},
+			chipset: "BCM2709",
+			model:   "Raspberry Pi 2 Model B Rev 1.1",
+		}},
+	}
+	for _, tt := range tests {
+		hw, err := readHardware(fixtureFS(t, tt.fixture))
+		if err != nil {
+			t.Errorf("%s: %v", tt.fixture, err)
+			continue
+		}
+		if !reflect.DeepEqual(hw, tt.want) {
+			t.Errorf("%s: readHardware() = %+v, want %+v", tt.fixture, hw, tt.want)
+		}
+	}
+}
+
+func TestReadCpuinfo(t *testing.T) {
+	tests := []struct {
+		fixture    string
+		cpus       int
+		processors int
+	}{
+		{"openwrt", 1, 1},
+		{"x86", 2, 2},
+		{"rpi2", 0, 4},
+	}
+	for _, tt := range tests {
+		cpus, processors, info, err := readCpuinfo(filepath.Join("testdata", tt.fixture, "proc", "cpuinfo"))
+		if err != nil {
+			t.Errorf("%s: %v", tt.fixture, err)
+			continue
+		}
+		if len(cpus) != tt.cpus || processors != tt.processors {
+			t.Errorf("%s: %d cpus, %d processors, want %d, %d", tt.fixture, len(cpus), processors, tt.cpus, tt.processors)
+		}
+		if info["processor"] != "0" {
+			t.Errorf("%s: first processor %q", tt.fixture, info["processor"])
+		}
+	}
+}
+
+func TestReadSysValue(t *testing.T) {
+	if got := readSysValue("testdata/openwrt/sys/firmware/devicetree/base/compatible"); got != "tplink,archer-c7-v5" {
+		t.Errorf("readSysValue() = %q", got)
+	}
+	if got := readSysValue("testdata/missing"); got != "" {
+		t.Errorf("readSysValue() of a missing file = %q", got)
+	}
+}
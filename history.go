@@ -0,0 +1,131 @@
+package main
+
+import (
+	"math"
+	"time"
+
+	alfredxml "github.com/lemmi/gnw/alfredxml"
+	"github.com/prometheus/procfs"
+	"github.com/vishvananda/netlink"
+)
+
+// history keeps samples from the previous crawl to report rates over the
+// reporting interval
+type history struct {
+	cpu      *procfs.CPUStat
+	ifaces   map[string]ifaceSample
+	sessions map[string]ifaceSessions
+	// clients seen in between crawls, nil if not watched
+	live *clientTable
+}
+
+type ifaceSample struct {
+	index int
+	time  time.Time
+	stats netlink.LinkStatistics
+}
+
+func cpuTotal(s procfs.CPUStat) float64 {
+	// guest time is already accounted in user and nice
+	return s.User + s.Nice + s.System + s.Idle + s.Iowait + s.IRQ + s.SoftIRQ + s.Steal
+}
+
+// cpuUsage returns the cpu utilization since the previous sample in percent, or
+// nil for the first sample or after the counters were reset
+func (h *history) cpuUsage(cur procfs.CPUStat) *alfredxml.CPUUsage {
+	prev := h.cpu
+	h.cpu = &cur
+	if prev == nil {
+		return nil
+	}
+
+	total := cpuTotal(cur) - cpuTotal(*prev)
+	if total <= 0 || cur.Idle < prev.Idle {
+		return nil
+	}
+
+	percent := func(cur, prev float64) float64 {
+		return 100 * (cur - prev) / total
+	}
+	return &alfredxml.CPUUsage{
+		User:    percent(cur.User, prev.User),
+		Nice:    percent(cur.Nice, prev.Nice),
+		System:  percent(cur.System, prev.System),
+		Iowait:  percent(cur.Iowait, prev.Iowait),
+		IRQ:     percent(cur.IRQ, prev.IRQ),
+		SoftIRQ: percent(cur.SoftIRQ, prev.SoftIRQ),
+		Steal:   percent(cur.Steal, prev.Steal),
+		Idle:    percent(cur.Idle, prev.Idle),
+	}
+}
+
+// counterDelta returns the increase of a counter. Some drivers only provide 32
+// bit counters, which may wrap when they were close to the limit. Any other
+// decrease is a reset.
+func counterDelta(cur, prev uint64) (uint64, bool) {
+	switch {
+	case cur >= prev:
+		return cur - prev, true
+	case prev <= math.MaxUint32 && prev > math.MaxUint32/2 && cur < math.MaxUint32/2:
+		return cur + (math.MaxUint32 - prev) + 1, true
+	}
+	return 0, false
+}
+
+// trafficRates sets the traffic rates of iface since the previous sample of
+// the same link. Rates are omitted for the first sample, when the link was
+// recreated or when the counters were reset.
+func (h *history) trafficRates(iface *alfredxml.Interface, attrs *netlink.LinkAttrs, now time.Time) {
+	if attrs.Statistics == nil {
+		return
+	}
+	cur := *attrs.Statistics
+
+	iface.RxErrors = cur.RxErrors
+	iface.TxErrors = cur.TxErrors
+	iface.RxDropped = cur.RxDropped
+	iface.TxDropped = cur.TxDropped
+
+	if h.ifaces == nil {
+		h.ifaces = map[string]ifaceSample{}
+	}
+	prev, ok := h.ifaces[attrs.Name]
+	h.ifaces[attrs.Name] = ifaceSample{
+		index: attrs.Index,
+		time:  now,
+		stats: cur,
+	}
+	if !ok || prev.index != attrs.Index {
+		return
+	}
+
+	interval := now.Sub(prev.time).Seconds()
+	if interval <= 0 {
+		return
+	}
+
+	rxBytes, ok1 := counterDelta(cur.RxBytes, prev.stats.RxBytes)
+	txBytes, ok2 := counterDelta(cur.TxBytes, prev.stats.TxBytes)
+	rxPackets, ok3 := counterDelta(cur.RxPackets, prev.stats.RxPackets)
+	txPackets, ok4 := counterDelta(cur.TxPackets, prev.stats.TxPackets)
+	if !ok1 || !ok2 || !ok3 || !ok4 {
+		return
+	}
+
+	iface.Rates = &alfredxml.InterfaceRates{
+		Interval:  interval,
+		RxBytes:   float64(rxBytes) / interval,
+		TxBytes:   float64(txBytes) / interval,
+		RxPackets: float64(rxPackets) / interval,
+		TxPackets: float64(txPackets) / interval,
+	}
+}
+
+// pruneIfaces forgets all links that were not sampled at now
+func (h *history) pruneIfaces(now time.Time) {
+	for name, s := range h.ifaces {
+		if !s.time.Equal(now) {
+			delete(h.ifaces, name)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	alfredxml "github.com/lemmi/gnw/alfredxml"
+	"github.com/prometheus/procfs"
+	"github.com/vishvananda/netlink"
+)
+
+func TestCounterDelta(t *testing.T) {
+	tests := []struct {
+		cur, prev uint64
+		want      uint64
+		ok        bool
+	}{
+		{100, 100, 0, true},
+		{150, 100, 50, true},
+		// 32 bit counter wrapped
+		{10, math.MaxUint32 - 5, 16, true},
+		// reset
+		{10, 1000, 0, false},
+		// 64 bit counters don't wrap in practice
+		{10, math.MaxUint32 + 100, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := counterDelta(tt.cur, tt.prev)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("counterDelta(%d, %d) = %d, %v, want %d, %v", tt.cur, tt.prev, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCPUUsage(t *testing.T) {
+	var h history
+	if u := h.cpuUsage(procfs.CPUStat{User: 100, System: 50, Idle: 850}); u != nil {
+		t.Errorf("first sample = %+v, want nil", u)
+	}
+
+	u := h.cpuUsage(procfs.CPUStat{User: 120, System: 60, Idle: 920})
+	want := alfredxml.CPUUsage{User: 20, System: 10, Idle: 70}
+	if u == nil || *u != want {
+		t.Errorf("cpuUsage() = %+v, want %+v", u, want)
+	}
+
+	// counters went backwards
+	if u := h.cpuUsage(procfs.CPUStat{User: 1, Idle: 1}); u != nil {
+		t.Errorf("after reset = %+v, want nil", u)
+	}
+}
+
+func TestTrafficRates(t *testing.T) {
+	var h history
+	now := time.Now()
+	attrs := &netlink.LinkAttrs{
+		Name:       "eth0",
+		Index:      2,
+		Statistics: &netlink.LinkStatistics{RxBytes: 1000, TxBytes: 2000, RxPackets: 10, TxPackets: 20, RxErrors: 1},
+	}
+
+	var iface alfredxml.Interface
+	h.trafficRates(&iface, attrs, now)
+	if iface.Rates != nil || iface.RxErrors != 1 {
+		t.Errorf("first sample rates %+v errors %d", iface.Rates, iface.RxErrors)
+	}
+
+	now = now.Add(10 * time.Second)
+	attrs.Statistics = &netlink.LinkStatistics{RxBytes: 2000, TxBytes: 2500, RxPackets: 20, TxPackets: 25}
+	iface = alfredxml.Interface{}
+	h.trafficRates(&iface, attrs, now)
+	want := alfredxml.InterfaceRates{Interval: 10, RxBytes: 100, TxBytes: 50, RxPackets: 1, TxPackets: 0.5}
+	if iface.Rates == nil || *iface.Rates != want {
+		t.Errorf("rates = %+v, want %+v", iface.Rates, want)
+	}
+
+	// a recreated link starts over
+	now = now.Add(10 * time.Second)
+	attrs.Index = 3
+	iface = alfredxml.Interface{}
+	h.trafficRates(&iface, attrs, now)
+	if iface.Rates != nil {
+		t.Errorf("recreated link rates = %+v, want nil", iface.Rates)
+	}
+
+	h.pruneIfaces(now.Add(time.Second))
+	if len(h.ifaces) != 0 {
+		t.Errorf("%d interfaces left after pruning", len(h.ifaces))
+	}
+}
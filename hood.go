@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/lemmi/closer"
+)
+
+// hood describes the area of a hood either by polygons or by a centre and a
+// radius in meters. A radius of 0 makes the hood match everywhere, when no
+// other hood matches.
+//
+// The hood file contains a JSON list of hoods:
+//
+//	[
+//		{"id": "1", "name": "Fuerth", "lat": 49.47, "lng": 10.99, "radius": 5000},
+//		{"id": "2", "name": "Nuernberg", "polygons": [[[49.4, 11.0], [49.5, 11.1], [49.4, 11.2]]]}
+//	]
+type hood struct {
+	ID       string
+	Name     string
+	Lat      float64
+	Lng      float64
+	Radius   float64
+	Polygons [][][2]float64
+}
+
+func readHoods(path string) ([]hood, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Do(f)
+
+	var hoods []hood
+	if err := json.NewDecoder(f).Decode(&hoods); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return hoods, nil
+}
+
+// inPolygon uses ray casting to test if the point is inside the polygon
+func inPolygon(lat, lng float64, polygon [][2]float64) bool {
+	var in bool
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		a, b := polygon[i], polygon[j]
+		if (a[1] > lng) != (b[1] > lng) &&
+			lat < (b[0]-a[0])*(lng-a[1])/(b[1]-a[1])+a[0] {
+			in = !in
+		}
+	}
+	return in
+}
+
+// distance returns the great circle distance in meters
+func distance(lat1, lng1, lat2, lng2 float64) float64 {
+	const earthRadius = 6371000
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dlat := rad(lat2 - lat1)
+	dlng := rad(lng2 - lng1)
+	a := math.Sin(dlat/2)*math.Sin(dlat/2) +
+		math.Cos(rad(lat1))*math.Cos(rad(lat2))*math.Sin(dlng/2)*math.Sin(dlng/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+// hoodAt returns the hood at the given position. Polygons take precedence over
+// the nearest centre within its radius, hoods without a radius only match if
+// no other hood does.
+func hoodAt(hoods []hood, lat, lng float64) (hood, bool) {
+	for _, h := range hoods {
+		for _, p := range h.Polygons {
+			if inPolygon(lat, lng, p) {
+				return h, true
+			}
+		}
+	}
+
+	if h, ok := nearestHood(hoods, lat, lng, false); ok {
+		return h, true
+	}
+	return nearestHood(hoods, lat, lng, true)
+}
+
+// nearestHood returns the nearest hood with a centre that contains the
+// position, either among the hoods with a radius or the catch-all ones
+func nearestHood(hoods []hood, lat, lng float64, catchAll bool) (hood, bool) {
+	var best hood
+	var found bool
+	bestDist := math.Inf(1)
+	for _, h := range hoods {
+		if len(h.Polygons) > 0 || (h.Radius == 0) != catchAll {
+			continue
+		}
+		d := distance(lat, lng, h.Lat, h.Lng)
+		if (catchAll || d <= h.Radius) && d < bestDist {
+			best, bestDist, found = h, d, true
+		}
+	}
+	return best, found
+}
+
+// configHoods fills Hood, Hoodid and Hoods from the hood file. Disagreements
+// between the configured hood and the position are returned as warnings.
+func configHoods(c Config) (Config, []string, error) {
+	if c.HoodFile == "" {
+		return c, nil, nil
+	}
+
+	hoods, err := readHoods(c.HoodFile)
+	if err != nil {
+		return c, nil, err
+	}
+
+	var warnings []string
+	if c.Origins["Lat"] != "" && c.Origins["Lng"] != "" {
+		h, ok := hoodAt(hoods, c.Lat, c.Lng)
+		switch {
+		case !ok:
+			warnings = append(warnings, fmt.Sprintf("no hood found at %v/%v", c.Lat, c.Lng))
+		case c.Hood == "":
+			c.Hood = h.Name
+			c.Origins["Hood"] = "hoodfile"
+		case c.Hood != h.Name:
+			warnings = append(warnings, fmt.Sprintf("configured hood %q does not match hood %q at %v/%v", c.Hood, h.Name, c.Lat, c.Lng))
+		}
+	}
+
+	names := make([]string, 0, len(hoods))
+	for _, h := range hoods {
+		names = append(names, h.Name)
+		if c.Hoodid == "" && h.Name == c.Hood && h.ID != "" {
+			c.Hoodid = h.ID
+			c.Origins["Hoodid"] = "hoodfile"
+		}
+	}
+	if c.Hoods == "" {
+		c.Hoods = strings.Join(names, ",")
+		c.Origins["Hoods"] = "hoodfile"
+	}
+
+	return c, warnings, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestInPolygon(t *testing.T) {
+	square := [][2]float64{{0, 0}, {0, 10}, {10, 10}, {10, 0}}
+	// concave, the notch covers lat 4-6, lng 5-10
+	notched := [][2]float64{{0, 0}, {0, 10}, {4, 10}, {4, 5}, {6, 5}, {6, 10}, {10, 10}, {10, 0}}
+
+	tests := []struct {
+		name     string
+		polygon  [][2]float64
+		lat, lng float64
+		want     bool
+	}{
+		{"inside", square, 5, 5, true},
+		{"outside", square, 15, 5, false},
+		{"beyond lng", square, 5, -1, false},
+		{"notch", notched, 5, 7, false},
+		{"below notch", notched, 2, 7, true},
+		{"beside notch", notched, 5, 2, true},
+		{"empty", nil, 0, 0, false},
+	}
+	for _, tt := range tests {
+		if got := inPolygon(tt.lat, tt.lng, tt.polygon); got != tt.want {
+			t.Errorf("%s: inPolygon(%v, %v) = %v, want %v", tt.name, tt.lat, tt.lng, got, tt.want)
+		}
+	}
+}
+
+func TestHoodAt(t *testing.T) {
+	hoods, err := readHoods("testdata/hoods.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		lat, lng float64
+		want     string
+	}{
+		// inside the polygon, even though Fuerth's centre is closer
+		{"polygon", 49.46, 11.01, "Nuernberg"},
+		{"radius", 49.58, 11.01, "Erlangen"},
+		// outside all radii, the hood without radius catches everything
+		{"fallback", 48.00, 12.00, "Default"},
+	}
+	for _, tt := range tests {
+		h, ok := hoodAt(hoods, tt.lat, tt.lng)
+		if !ok || h.Name != tt.want {
+			t.Errorf("%s: hoodAt(%v, %v) = %q, %v, want %q", tt.name, tt.lat, tt.lng, h.Name, ok, tt.want)
+		}
+	}
+
+	if h, ok := hoodAt(hoods[:3], 48.00, 12.00); ok {
+		t.Errorf("hoodAt() outside all hoods = %q", h.Name)
+	}
+}
+
+func TestHoodAtCatchAll(t *testing.T) {
+	hoods := []hood{
+		{ID: "1", Name: "Erlangen", Lat: 49.59, Lng: 11.00, Radius: 5000},
+		// closer to the position than Erlangen's centre
+		{ID: "2", Name: "Default", Lat: 49.60, Lng: 11.01},
+		{ID: "3", Name: "Other", Lat: 40.00, Lng: 10.00},
+	}
+
+	if h, ok := hoodAt(hoods, 49.60, 11.00); !ok || h.Name != "Erlangen" {
+		t.Errorf("within radius: hoodAt() = %q, %v, want Erlangen", h.Name, ok)
+	}
+	// the nearest catch-all wins outside all radii
+	if h, ok := hoodAt(hoods, 49.80, 11.00); !ok || h.Name != "Default" {
+		t.Errorf("outside radius: hoodAt() = %q, %v, want Default", h.Name, ok)
+	}
+}
+
+func TestConfigHoods(t *testing.T) {
+	c := Config{
+		HoodFile: "testdata/hoods.json",
+		Lat:      49.58,
+		Lng:      11.01,
+		Origins:  map[string]string{"Lat": "flag", "Lng": "flag"},
+	}
+	c, warnings, err := configHoods(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("warnings %v", warnings)
+	}
+	if c.Hood != "Erlangen" || c.Hoodid != "3" || c.Hoods != "Nuernberg,Fuerth,Erlangen,Default" {
+		t.Errorf("Hood %q Hoodid %q Hoods %q", c.Hood, c.Hoodid, c.Hoods)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func newTLSConfig(c Config) (*tls.Config, error) {
+	conf := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if c.TLSMinVersion != "" {
+		v, ok := tlsVersions[c.TLSMinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown TLS version %q", c.TLSMinVersion)
+		}
+		conf.MinVersion = v
+	}
+
+	if c.CACert != "" {
+		pem, err := os.ReadFile(c.CACert)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %q", c.CACert)
+		}
+		conf.RootCAs = pool
+	}
+
+	switch {
+	case c.ClientCert != "" && c.ClientKey != "":
+		cert, err := tls.LoadX509KeyPair(c.ClientCert, c.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	case c.ClientCert != "" || c.ClientKey != "":
+		return nil, fmt.Errorf("client certificate and key must be given together")
+	}
+
+	return conf, nil
+}
+
+func newDialer(c Config) (*net.Dialer, error) {
+	d := &net.Dialer{
+		Timeout: 30 * time.Second,
+	}
+
+	if c.SourceAddr != "" {
+		ip := net.ParseIP(c.SourceAddr)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid source address %q", c.SourceAddr)
+		}
+		d.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+
+	if c.SourceIf != "" {
+		ifname := c.SourceIf
+		d.Control = func(network, address string, rc syscall.RawConn) error {
+			var serr error
+			err := rc.Control(func(fd uintptr) {
+				serr = unix.SetsockoptString(int(fd), unix.SOL_SOCKET, unix.SO_BINDTODEVICE, ifname)
+			})
+			if err != nil {
+				return err
+			}
+			return serr
+		}
+	}
+
+	return d, nil
+}
+
+// proxyURL parses the Proxy option. The scheme is required, as url.Parse would
+// take the host of "proxy:3128" for one.
+func proxyURL(proxy string) (*url.URL, error) {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %v", proxy, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("invalid proxy %q, expected http, https or socks5 URL", proxy)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q, host missing", proxy)
+	}
+	return u, nil
+}
+
+// newHTTPClient builds the client used to send reports, honoring the proxy,
+// TLS and source binding options
+func newHTTPClient(c Config) (*http.Client, error) {
+	tlsConf, err := newTLSConfig(c)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer, err := newDialer(c)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if c.Proxy != "" {
+		u, err := proxyURL(c.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		proxy = http.ProxyURL(u)
+	}
+
+	return &http.Client{
+		Timeout: time.Minute,
+		Transport: &http.Transport{
+			Proxy:               proxy,
+			DialContext:         dialer.DialContext,
+			TLSClientConfig:     tlsConf,
+			TLSHandshakeTimeout: 10 * time.Second,
+			DisableKeepAlives:   true,
+		},
+	}, nil
+}
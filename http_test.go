@@ -0,0 +1,79 @@
+package main
+
+import (
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProxyURL(t *testing.T) {
+	tests := []struct {
+		proxy string
+		ok    bool
+	}{
+		{"http://proxy:3128", true},
+		{"https://proxy.example.com", true},
+		{"socks5://127.0.0.1:1080", true},
+		{"proxy:3128", false},
+		{"proxy", false},
+		{"ftp://proxy", false},
+		{"http://", false},
+		{"http://[::1", false},
+	}
+	for _, tt := range tests {
+		if _, err := proxyURL(tt.proxy); (err == nil) != tt.ok {
+			t.Errorf("proxyURL(%q) error = %v", tt.proxy, err)
+		}
+	}
+
+	if errs := configValidate(nil, Config{Proxy: "proxy:3128"}, nil); len(errs) != 1 {
+		t.Errorf("configValidate() = %v, want one error", errs)
+	}
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	conf, err := newTLSConfig(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.MinVersion != tls.VersionTLS12 {
+		t.Errorf("default MinVersion = %#x", conf.MinVersion)
+	}
+
+	conf, err = newTLSConfig(Config{TLSMinVersion: "1.3"})
+	if err != nil || conf.MinVersion != tls.VersionTLS13 {
+		t.Errorf("TLSMinVersion 1.3 = %v, %v", conf, err)
+	}
+
+	notPEM := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, c := range map[string]Config{
+		"unknown version":              {TLSMinVersion: "1.4"},
+		"cert without key":             {ClientCert: "client.pem"},
+		"key without cert":             {ClientKey: "client.key"},
+		"missing CA file":              {CACert: filepath.Join(t.TempDir(), "missing.pem")},
+		"CA file without certificates": {CACert: notPEM},
+	} {
+		if _, err := newTLSConfig(c); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestNewDialer(t *testing.T) {
+	d, err := newDialer(Config{SourceAddr: "192.0.2.1", SourceIf: "eth0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.LocalAddr.String() != "192.0.2.1:0" || d.Control == nil {
+		t.Errorf("LocalAddr %v Control set %v", d.LocalAddr, d.Control != nil)
+	}
+
+	if _, err := newDialer(Config{SourceAddr: "node1"}); err == nil {
+		t.Error("invalid source address accepted")
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadOrCreateKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gnw.key")
+
+	key, err := loadOrCreateKey(testConfig(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("key file mode %v, want 0600", info.Mode().Perm())
+	}
+
+	reloaded, err := loadOrCreateKey(testConfig(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reloaded.Equal(key) {
+		t.Error("reloaded key differs from the created one")
+	}
+}
+
+func TestLoadOrCreateKeyInvalid(t *testing.T) {
+	dir := t.TempDir()
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string][]byte{
+		"ecdsa.key":   pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}),
+		"cert.pem":    pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("x")}),
+		"garbage.key": []byte("not a key"),
+		"broken.key":  pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("x")}),
+	}
+	for name, b := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, b, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadOrCreateKey(testConfig(), path); err == nil {
+			t.Errorf("%s: loaded", name)
+		}
+		// the invalid file must not be replaced
+		if got, _ := os.ReadFile(path); string(got) != string(b) {
+			t.Errorf("%s: file modified", name)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"log/syslog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// log formats
+const (
+	logfmt  = "logfmt"
+	logJSON = "json"
+)
+
+// severityWriter passes each formatted record to write together with its
+// level. The level is set by severityHandler right before the record is
+// formatted.
+type severityWriter struct {
+	mu    sync.Mutex
+	level slog.Level
+	write func(level slog.Level, line string) error
+}
+
+func (w *severityWriter) Write(p []byte) (int, error) {
+	if err := w.write(w.level, strings.TrimSuffix(string(p), "\n")); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// severityHandler wraps a text or json handler writing to a severityWriter,
+// so sinks like syslog see the level of every record
+type severityHandler struct {
+	slog.Handler
+	w *severityWriter
+}
+
+func (h severityHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.w.mu.Lock()
+	defer h.w.mu.Unlock()
+	h.w.level = r.Level
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h severityHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return severityHandler{Handler: h.Handler.WithAttrs(attrs), w: h.w}
+}
+
+func (h severityHandler) WithGroup(name string) slog.Handler {
+	return severityHandler{Handler: h.Handler.WithGroup(name), w: h.w}
+}
+
+// syslogPriority maps a level to the syslog severity
+func syslogPriority(level slog.Level) syslog.Priority {
+	switch {
+	case level >= slog.LevelError:
+		return syslog.LOG_ERR
+	case level >= slog.LevelWarn:
+		return syslog.LOG_WARNING
+	case level >= slog.LevelInfo:
+		return syslog.LOG_INFO
+	}
+	return syslog.LOG_DEBUG
+}
+
+func syslogWrite(w *syslog.Writer) func(slog.Level, string) error {
+	return func(level slog.Level, line string) error {
+		switch syslogPriority(level) {
+		case syslog.LOG_ERR:
+			return w.Err(line)
+		case syslog.LOG_WARNING:
+			return w.Warning(line)
+		case syslog.LOG_INFO:
+			return w.Info(line)
+		}
+		return w.Debug(line)
+	}
+}
+
+// journaldWrite prefixes every line with its severity, which journald picks up
+// from the output of services
+func journaldWrite(out io.Writer) func(slog.Level, string) error {
+	return func(level slog.Level, line string) error {
+		_, err := fmt.Fprintf(out, "<%d>%s\n", syslogPriority(level), line)
+		return err
+	}
+}
+
+func newLogHandler(c Config, w io.Writer, opts *slog.HandlerOptions) slog.Handler {
+	if c.LogFormat == logJSON {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+// newLogger logs to syslog, to stderr for journald or to stdout in logfmt or
+// json. Debug messages are only logged with -d.
+func newLogger(c Config) *slog.Logger {
+	opts := &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+	}
+	if c.Debug {
+		opts.Level = slog.LevelDebug
+	}
+
+	// syslog and journald add their own timestamps
+	sinkOpts := *opts
+	sinkOpts.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+		if len(groups) == 0 && a.Key == slog.TimeKey {
+			return slog.Attr{}
+		}
+		return a
+	}
+
+	var fallback error
+	switch {
+	case c.Syslog:
+		sw, err := syslog.New(syslog.LOG_NOTICE|syslog.LOG_DAEMON, "gnw")
+		if err == nil {
+			w := &severityWriter{write: syslogWrite(sw)}
+			return slog.New(severityHandler{Handler: newLogHandler(c, w, &sinkOpts), w: w})
+		}
+		fallback = err
+	case c.Journald:
+		w := &severityWriter{write: journaldWrite(os.Stderr)}
+		return slog.New(severityHandler{Handler: newLogHandler(c, w, &sinkOpts), w: w})
+	}
+
+	l := slog.New(newLogHandler(c, os.Stdout, opts))
+	if fallback != nil {
+		l.Warn("Can't open syslog, falling back to normal logger", "err", fallback)
+	}
+	return l
+}
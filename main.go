@@ -17,6 +17,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/hashicorp/go-multierror"
 	"github.com/lemmi/closer"
 	alfredxml "github.com/lemmi/gnw/alfredxml"
 	"github.com/prometheus/procfs"
@@ -35,7 +36,7 @@ func getBabeldInfo(c Config) (string, []alfredxml.BabelNeighbour) {
 	}
 	defer closer.WithStackTrace(conn)
 	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
-		c.Log.Println(err)
+		c.Log.Warn("Can't query babeld", "err", err)
 		return "", nil
 	}
 
@@ -86,7 +87,7 @@ func getBirdInfo(c Config) (string, []alfredxml.BabelNeighbour) {
 	}
 	defer closer.WithStackTrace(conn)
 	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
-		c.Log.Println(err)
+		c.Log.Warn("Can't query bird", "err", err)
 		return "", nil
 	}
 
@@ -146,65 +147,123 @@ func netInterfaceFromLink(link netlink.Link) net.Interface {
 	}
 }
 
-func crawl(c Config) (d alfredxml.Data, err error) {
+// collectError records a failure while gathering one section of the report.
+// Failures in optional sections only degrade the report, all others make it
+// unusable.
+type collectError struct {
+	section  string
+	optional bool
+	err      error
+}
+
+func (e collectError) Error() string {
+	return fmt.Sprintf("%s: %v", e.section, e.err)
+}
+
+// partialOnly reports whether err consists solely of optional collectErrors,
+// in which case the report can still be sent.
+func partialOnly(err error) bool {
+	switch e := err.(type) {
+	case nil:
+		return true
+	case collectError:
+		return e.optional
+	case *multierror.Error:
+		for _, we := range e.WrappedErrors() {
+			if !partialOnly(we) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func required(section string, err error) error {
+	return collectError{section: section, err: err}
+}
+
+func optional(section string, err error) error {
+	return collectError{section: section, optional: true, err: err}
+}
+
+func crawl(c Config, h *history) (d alfredxml.Data, err error) {
 	nlhandle, err := netlink.NewHandle()
 	if err != nil {
-		return
+		return d, required("netlink", err)
 	}
 	defer nlhandle.Delete()
 
-	fs, err := procfs.NewFS("/proc")
+	fs, err := newHostFS(c)
 	if err != nil {
-		return
+		return d, required("procfs", err)
 	}
-	stat, err := fs.Stat()
+	stat, err := fs.proc.Stat()
 	if err != nil {
-		return
+		return d, required("stat", err)
 	}
 
 	{
-		var mem meminfo
-		mem, err = readMeminfo(c)
+		var mem procfs.Meminfo
+		mem, err = fs.proc.Meminfo()
 		if err != nil {
-			return
+			return d, required("meminfo", err)
 		}
 
 		var load loadavg
-		load, err = readLoadavg()
+		load, err = readLoadavg(fs)
 		if err != nil {
-			return
+			return d, required("loadavg", err)
 		}
 
 		var sysinfo unix.Sysinfo_t
 		if err = unix.Sysinfo(&sysinfo); err != nil {
-			return
+			return d, required("sysinfo", err)
 		}
 
 		d.SystemData.Status = "online"
 		d.SystemData.Idletime = stat.CPUTotal.Idle
 		d.SystemData.Loadavg = load.load15
 		d.SystemData.LocalTime = time.Now().Unix()
-		d.SystemData.MemoryBuffering = mem.Buffers
-		d.SystemData.MemoryCaching = mem.Cached
-		d.SystemData.MemoryFree = mem.MemFree
-		d.SystemData.MemoryTotal = mem.MemTotal
-		d.SystemData.MemoryAvailable = mem.MemAvailable
+		d.SystemData.MemoryBuffering = kb(mem.Buffers)
+		d.SystemData.MemoryCaching = kb(mem.Cached)
+		d.SystemData.MemoryFree = kb(mem.MemFree)
+		d.SystemData.MemoryTotal = kb(mem.MemTotal)
+		d.SystemData.MemoryAvailable = kb(mem.MemAvailable)
 		d.SystemData.Processes = fmt.Sprintf("%d/%d", load.runnable, load.procs)
 		d.SystemData.Uptime = float64(sysinfo.Uptime)
+
+		d.ExtendedSystemData.Load1 = load.load1
+		d.ExtendedSystemData.Load5 = load.load5
+		d.ExtendedSystemData.Load15 = load.load15
+		d.ExtendedSystemData.CPUUsage = h.cpuUsage(stat.CPUTotal)
 	}
 
 	{
 		var utsname unix.Utsname
 		if err = unix.Uname(&utsname); err != nil {
-			return
+			return d, required("uname", err)
 		}
 		d.SystemData.KernelVersion = string(bytes.Trim(utsname.Release[:], "\x00"))
 	}
 
+	// failures in optional sections are collected and returned alongside the
+	// partial report
+	var partial *multierror.Error
+
+	if hw, err := readHardware(fs); err != nil {
+		partial = multierror.Append(partial, optional("hardware", err))
+	} else {
+		d.SystemData.CPU = hw.cpu
+		d.SystemData.Chipset = hw.chipset
+		d.SystemData.Model = hw.model
+	}
+
 	links, err := nlhandle.LinkList()
 	if err != nil {
-		return
+		return d, required("links", err)
 	}
+	now := time.Now()
 
 	// sort links by name and make sure "client" interface is sorted first
 	sort.Slice(links, func(i, j int) bool {
@@ -224,6 +283,21 @@ func crawl(c Config) (d alfredxml.Data, err error) {
 		links[0].Attrs().Name = "br-client"
 	}
 
+	if tunnels, err := readTunnels(c, links); err != nil {
+		partial = multierror.Append(partial, optional("tunnels", err))
+	} else {
+		d.Tunnels.Tunnels = tunnels
+		for _, t := range tunnels {
+			d.SystemData.VpnActive |= t.Active
+		}
+	}
+
+	var live map[int][]net.HardwareAddr
+	if h.live != nil {
+		live = h.live.drain()
+	}
+
+	var clients []ifaceClients
 	for _, link := range links {
 		// skip lo
 		attrs := link.Attrs()
@@ -235,69 +309,77 @@ func crawl(c Config) (d alfredxml.Data, err error) {
 			continue
 		}
 
-		d.InterfaceData.Interfaces = append(d.InterfaceData.Interfaces, alfredxml.Interface{
+		iface := alfredxml.Interface{
 			XMLName: xml.Name{
 				Local: attrs.Name,
 			},
-			Name:      attrs.Name,
-			Mtu:       attrs.MTU,
-			MacAddr:   attrs.HardwareAddr.String(),
-			TrafficRx: attrs.Statistics.RxBytes,
-			TrafficTx: attrs.Statistics.TxBytes,
-		})
+			Name:    attrs.Name,
+			Mtu:     attrs.MTU,
+			MacAddr: attrs.HardwareAddr.String(),
+		}
+		if attrs.Statistics != nil {
+			iface.TrafficRx = attrs.Statistics.RxBytes
+			iface.TrafficTx = attrs.Statistics.TxBytes
+		}
+		h.trafficRates(&iface, attrs, now)
+		d.InterfaceData.Interfaces = append(d.InterfaceData.Interfaces, iface)
 
 		// only run neighbour discovery on layer2 devices
 		if len(bytes.Trim(attrs.HardwareAddr, "\x00")) == 0 {
 			continue
 		}
 
-		neighs, err := nlhandle.NeighList(attrs.Index, netlink.FAMILY_ALL)
-		if err != nil {
-			return d, err
+		var macs []net.HardwareAddr
+		switch countMethod(c, attrs.Name) {
+		case countFDB:
+			macs, err = fdbClients(c, nlhandle, link)
+		default:
+			macs, err = neighClients(c, nlhandle, link)
+			// include clients that were only reachable in between crawls
+			macs = mergeClients(macs, live[attrs.Index])
 		}
-
-		var neighProbe []netip.Addr
-		for _, neigh := range neighs {
-			if neigh.State&netlink.NUD_REACHABLE == 0 {
-				if neigh.IP.IsLinkLocalUnicast() {
-					if addr, ok := netip.AddrFromSlice(neigh.IP); ok {
-						neighProbe = append(neighProbe, addr)
-					}
-				}
-			}
-		}
-
-		nc, err := newNDP()
 		if err != nil {
-			return d, err
-		}
-		defer nc.Close()
-		_, err = nc.solicit(2*time.Second, netInterfaceFromLink(link), neighProbe...)
-		if err != nil {
-			return d, err
-		}
-
-		neighAddrs := map[string]struct{}{}
-		neighs, err = nlhandle.NeighList(attrs.Index, netlink.FAMILY_ALL)
-		if err != nil {
-			return d, err
-		}
-		for _, neigh := range neighs {
-			if neigh.State&netlink.NUD_REACHABLE > 0 {
-				neighAddrs[neigh.HardwareAddr.String()] = struct{}{}
-			}
+			partial = multierror.Append(partial, optional("clients "+attrs.Name, err))
+			continue
 		}
 
-		count := len(neighAddrs)
-		d.ClientCount += count
+		clients = append(clients, ifaceClients{name: attrs.Name, macs: macs})
 		d.Clients.Num = append(d.Clients.Num, alfredxml.ClientNum{
 			XMLName: xml.Name{
 				Local: attrs.Name,
 			},
-			N: count,
+			N: len(macs),
 		})
 	}
 
+	d.ClientCount, d.ClientBreakdown.Interfaces = dedupClients(clients)
+
+	var events []clientEvent
+	for _, ic := range clients {
+		s, e := h.clientSessions(ic.name, ic.macs, now)
+		d.ClientSessions.Interfaces = append(d.ClientSessions.Interfaces, s)
+		events = append(events, e...)
+
+		if c.Debug {
+			hashes := make([]string, 0, len(ic.macs))
+			for _, mac := range ic.macs {
+				hashes = append(hashes, clientHash.mac(mac))
+			}
+			sort.Strings(hashes)
+			c.Log.Debug("Clients", "iface", ic.name, "clients", strings.Join(hashes, " "))
+		}
+	}
+	if err := emitClientEvents(c, events); err != nil {
+		partial = multierror.Append(partial, optional("client events", err))
+	}
+
+	h.pruneIfaces(now)
+	h.pruneSessions(now)
+
+	if len(d.InterfaceData.Interfaces) == 0 {
+		return d, required("interfaces", fmt.Errorf("no usable interface found"))
+	}
+
 	babeldversion, babeldneighbours := getBabeldInfo(c)
 	birdversion, birdneighbours := getBirdInfo(c)
 	d.BabelNeighbours.Neighbours = append(babeldneighbours, birdneighbours...)
@@ -314,138 +396,334 @@ func crawl(c Config) (d alfredxml.Data, err error) {
 	d.SystemData.Geo.Lng = c.Lng
 	d.SystemData.PositionComment = c.PositionComment
 	d.SystemData.Hood = c.Hood
+	d.SystemData.Hoodid = c.Hoodid
 	d.SystemData.Contact = c.Contact
 	d.SystemData.Distname = c.Distname
 	d.SystemData.Distversion = c.Distversion
-	d.SystemData.FirmwareVersion = "Generic"
+	d.SystemData.FirmwareVersion = c.FirmwareVersion
+	d.SystemData.FirmwareRevision = c.FirmwareRevision
+	d.SystemData.OpenwrtCoreRevision = c.OpenwrtCoreRevision
+	d.SystemData.OpenwrtFeedsPackagesRevision = c.OpenwrtFeedsPackagesRevision
 	d.SystemData.NodewatcherVersion = VERSION
 
 	// unused
-	d.SystemData.Chipset = ""
-	d.SystemData.CPU = []string(nil)
-	d.SystemData.Model = ""
-	d.SystemData.Hoodid = ""
 	d.SystemData.BatmanAdvancedVersion = ""
-	d.SystemData.FirmwareRevision = ""
-	d.SystemData.OpenwrtCoreRevision = ""
-	d.SystemData.OpenwrtFeedsPackagesRevision = ""
-	d.SystemData.VpnActive = 0
 
-	return d, err
+	return d, partial.ErrorOrNil()
+}
+
+// linkLocal returns the IPv6 link-local address of link, if any
+func linkLocal(nlhandle *netlink.Handle, link netlink.Link) netip.Addr {
+	addrs, err := nlhandle.AddrList(link, netlink.FAMILY_V6)
+	if err != nil {
+		return netip.Addr{}
+	}
+	for _, a := range addrs {
+		if addr, ok := netip.AddrFromSlice(a.IP); ok && addr.IsLinkLocalUnicast() {
+			return addr
+		}
+	}
+	return netip.Addr{}
+}
+
+// arpSource returns the IPv4 address of link to send ARP requests from,
+// preferring one in the same subnet as target
+func arpSource(nlhandle *netlink.Handle, link netlink.Link, target netip.Addr) netip.Addr {
+	addrs, err := nlhandle.AddrList(link, netlink.FAMILY_V4)
+	if err != nil || len(addrs) == 0 {
+		return netip.IPv4Unspecified()
+	}
+	for _, a := range addrs {
+		if a.IPNet.Contains(target.AsSlice()) {
+			if src, ok := netip.AddrFromSlice(a.IP.To4()); ok {
+				return src
+			}
+		}
+	}
+	if src, ok := netip.AddrFromSlice(addrs[0].IP.To4()); ok {
+		return src
+	}
+	return netip.IPv4Unspecified()
+}
+
+// neighClients probes stale neighbours of link via NDP and ARP and returns the
+// distinct hardware addresses that are reachable afterwards.
+func neighClients(c Config, nlhandle *netlink.Handle, link netlink.Link) ([]net.HardwareAddr, error) {
+	attrs := link.Attrs()
+	neighs, err := nlhandle.NeighList(attrs.Index, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, err
+	}
+
+	var neighProbe, arpProbe []netip.Addr
+	for _, neigh := range neighs {
+		if neigh.State&netlink.NUD_REACHABLE != 0 || neigh.State&(netlink.NUD_NOARP|netlink.NUD_PERMANENT) != 0 {
+			continue
+		}
+		addr, ok := netip.AddrFromSlice(neigh.IP)
+		if !ok {
+			continue
+		}
+		addr = addr.Unmap()
+		switch {
+		case addr.Is4():
+			arpProbe = append(arpProbe, addr)
+		case addr.IsLinkLocalUnicast():
+			neighProbe = append(neighProbe, addr)
+		}
+	}
+
+	iface := netInterfaceFromLink(link)
+
+	nc, err := newNDP(c.Log)
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Do(nc)
+
+	// discovery replies are buffered while probing stale neighbours
+	dc, err := startDiscovery(c, nc, iface, linkLocal(nlhandle, link))
+	if err != nil {
+		return nil, err
+	}
+	if dc != nil {
+		defer closer.Do(dc)
+	}
+
+	nas, err := nc.solicit(2*time.Second, iface, neighProbe...)
+	if err != nil {
+		return nil, err
+	}
+
+	var arps []arpReply
+	if len(arpProbe) > 0 {
+		ac, err := newARP(iface)
+		if err != nil {
+			return nil, err
+		}
+		defer closer.Do(ac)
+		arps, err = ac.probe(2*time.Second, arpSource(nlhandle, link, arpProbe[0]), arpProbe...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var discovered []net.HardwareAddr
+	if dc != nil {
+		discovered, err = dc.collect(2 * time.Second)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	neighAddrs := map[string]net.HardwareAddr{}
+	for _, mac := range discovered {
+		neighAddrs[mac.String()] = mac
+	}
+	for _, na := range nas {
+		if len(na.mac) > 0 {
+			neighAddrs[na.mac.String()] = na.mac
+		}
+	}
+	for _, reply := range arps {
+		neighAddrs[reply.mac.String()] = reply.mac
+	}
+	neighs, err = nlhandle.NeighList(attrs.Index, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, err
+	}
+	for _, neigh := range neighs {
+		if neigh.State&netlink.NUD_REACHABLE > 0 {
+			neighAddrs[neigh.HardwareAddr.String()] = neigh.HardwareAddr
+		}
+	}
+
+	macs := make([]net.HardwareAddr, 0, len(neighAddrs))
+	for _, mac := range neighAddrs {
+		macs = append(macs, mac)
+	}
+	return macs, nil
 }
 
 func sendReport(c Config, payload []byte) error {
-	req, err := http.NewRequest("POST", "https://monitoring.freifunk-franken.de/api/alfred2", bytes.NewReader(payload))
+	body, err := compress(c.Compression, payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", c.Endpoint, bytes.NewReader(body))
 	if err != nil {
 		return err
 	}
 
 	req.Close = true
 	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	if c.Compression != "" {
+		req.Header.Set("Content-Encoding", c.Compression)
+	}
+	// the signature also covers forwarded reports, see alfredxml.Sign. The
+	// caller clears the key for batches with unverified reports.
+	if c.Key != nil {
+		signature, publicKey := alfredxml.Sign(c.Key, payload)
+		req.Header.Set(alfredxml.SignatureHeader, signature)
+		req.Header.Set(alfredxml.PublicKeyHeader, publicKey)
+	}
 
 	if c.Debug {
-		c.Log.Println()
-		c.Log.Println("POST:")
-		c.Log.Println()
-		dump, err := httputil.DumpRequestOut(req, true)
+		dump, err := httputil.DumpRequestOut(req, c.Compression == "")
 		if err != nil {
 			return err
 		}
-		c.Log.Println(string(dump))
+		c.Log.Debug("POST", "request", string(dump))
 	}
 
 	if !c.Dry {
-		resp, err := http.DefaultClient.Do(req)
+		resp, err := c.Client.Do(req)
 		if err != nil {
 			return err
 		}
 		defer closer.WithStackTrace(resp.Body)
 
-		out := io.Discard
-		if c.Debug {
-			c.Log.Println()
-			c.Log.Println("HTTP Response:")
-			c.Log.Println()
-			out = os.Stdout
-		}
-		if _, err := io.Copy(out, resp.Body); err != nil {
-			c.Log.Println(err)
+		var out bytes.Buffer
+		if _, err := io.Copy(&out, resp.Body); err != nil {
 			return err
 		}
+		c.Log.Debug("HTTP response", "status", resp.Status, "body", out.String())
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("report: %s", resp.Status)
+		}
 	}
 
 	return nil
 }
 
-func prepareReport(c Config) ([]byte, error) {
-	d, err := crawl(c)
-	if err != nil {
+// sendReportRetry sends payload, retrying with an exponential backoff. It
+// reports whether the payload was sent.
+func sendReportRetry(c Config, payload []byte) bool {
+	const maxRetries = 6
+	for retries := uint(1); ; retries++ {
+		err := sendReport(c, payload)
+		if err == nil {
+			c.Log.Info("Successfully sent report")
+			return true
+		}
+
+		if retries == maxRetries {
+			c.Log.Error("Failed to send report, giving up", "err", err, "attempts", retries)
+			return false
+		}
+
+		delay := time.Second << (retries - 1)
+		c.Log.Warn("Failed to send report, retrying", "err", err, "delay", delay)
+		time.Sleep(delay)
+	}
+}
+
+func prepareReport(c Config, h *history, others []alfredxml.Data) ([]byte, error) {
+	d, err := crawl(c, h)
+	if !partialOnly(err) {
 		return nil, err
 	}
+	if err != nil {
+		c.Log.Warn("Sending partial report", "err", err)
+	}
 
 	if c.Debug {
-		c.Log.Println("XML Output:")
-		e := xml.NewEncoder(os.Stdout)
+		var out bytes.Buffer
+		e := xml.NewEncoder(&out)
 		e.Indent("", "\t")
 		if err := e.Encode(d); err != nil {
 			return nil, err
 		}
-		c.Log.Println()
+		c.Log.Debug("XML output", "xml", out.String())
 	}
 
-	payload, err := json.Marshal(alfredxml.Alfred2Slice{d})
+	// the own report goes last, so it can't be replaced by a forwarded one
+	payload, err := json.Marshal(append(alfredxml.Alfred2Slice(others), d))
 	if err != nil {
 		return nil, err
 	}
 
-	if c.Debug {
-		c.Log.Println()
-		c.Log.Println("Alfred2 Payload:")
-		c.Log.Println()
-		c.Log.Println(string(payload))
-	}
+	c.Log.Debug("Alfred2 payload", "payload", string(payload))
 
 	return payload, nil
 }
 
 func main() {
-	c, err := getConfig()
+	// gnw config check|dump [flags]
+	if len(os.Args) > 2 && os.Args[1] == "config" {
+		c, err := getConfig(os.Args[3:])
+		os.Exit(configCommand(c, err, os.Args[2]))
+	}
+
+	c, err := getConfig(os.Args[1:])
 	if err != nil {
-		c.Log.Println(err)
+		c.Log.Error("Invalid configuration", "err", err)
 		os.Exit(1)
 	}
 
-	c.Log.Println("Starting Nodewatcher")
+	c.Log.Info("Starting Nodewatcher", "version", VERSION)
+
+	c.Client, err = newHTTPClient(c)
+	if err != nil {
+		c.Log.Error("Can't set up the HTTP client", "err", err)
+		os.Exit(1)
+	}
 
-	maxRetries := uint(6)
-	if tr, ok := http.DefaultTransport.(*http.Transport); ok {
-		tr.DisableKeepAlives = true
+	if c.KeyFile != "" {
+		c.Key, err = loadOrCreateKey(c, c.KeyFile)
+		if err != nil {
+			c.Log.Error("Can't load the signing key", "file", c.KeyFile, "err", err)
+			os.Exit(1)
+		}
+		// add it to -forwarderkeys of the gateway this node reports to
+		_, publicKey := alfredxml.Sign(c.Key, nil)
+		c.Log.Info("Signing reports", "publickey", publicKey)
 	}
+
+	var agg *aggregator
+	if c.Listen != "" || c.DropDir != "" {
+		agg, err = newAggregator(c)
+		if err != nil {
+			c.Log.Error("Can't set up forwarding", "err", err)
+			os.Exit(1)
+		}
+	}
+	if c.Listen != "" {
+		go func() {
+			c.Log.Error("Listener failed", "addr", c.Listen, "err", agg.listen())
+			os.Exit(1)
+		}()
+	}
+
+	h := &history{live: newClientTable()}
+	go h.live.watch(c)
+
+	var failures uint
 	for {
-		c.Log.Println("Sending Report")
-		for retries := uint(1); retries <= maxRetries; retries++ {
-			payload, err := prepareReport(c)
-			if err != nil {
-				c.Log.Println("Failed to gather node information")
-				c.Log.Println(err)
+		c.Log.Info("Sending Report")
+		// crawl once per cycle, the history must span the whole interval
+		collected := time.Now()
+		others, verified := agg.collect()
+		payload, err := prepareReport(c, h, others)
+		if err != nil {
+			failures++
+			c.Log.Error("Failed to gather node information", "err", err, "failures", failures)
+			if c.MaxFailures > 0 && failures >= c.MaxFailures {
+				c.Log.Error("Giving up after consecutive failures", "failures", failures)
 				os.Exit(1)
 			}
-			err = sendReport(c, payload)
-			if err == nil {
-				c.Log.Println("Successfully sent report")
-				break
+			c.Log.Info("Retrying in the next cycle")
+		} else {
+			failures = 0
+			sc := c
+			if !verified && c.Key != nil {
+				c.Log.Warn("Sending unsigned report, it contains reports from the drop directory")
+				sc.Key = nil
 			}
-
-			c.Log.Println(err)
-
-			if retries == maxRetries {
-				c.Log.Println("Failed to send report, giving up")
-				break
+			if sendReportRetry(sc, payload) {
+				agg.forget(collected)
 			}
-
-			delay := time.Second << (retries - 1)
-			c.Log.Printf("Failed to send Report, retrying in %s", delay)
-			time.Sleep(delay)
 		}
 		runtime.GC()
 		time.Sleep(5 * time.Minute)
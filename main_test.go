@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSendReportRetry(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		if requests == 1 {
+			// drop the connection so the first attempt fails
+			hj, _ := w.(http.Hijacker)
+			conn, _, _ := hj.Hijack()
+			conn.Close()
+			return
+		}
+	}))
+	defer srv.Close()
+
+	c := testConfig()
+	c.Endpoint = srv.URL
+	c.Client = srv.Client()
+
+	if !sendReportRetry(c, []byte("{}")) {
+		t.Fatal("report not sent")
+	}
+	if requests != 2 {
+		t.Errorf("%d requests, want 2", requests)
+	}
+}
+
+func TestSendReportStatus(t *testing.T) {
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	c := testConfig()
+	c.Endpoint = srv.URL
+	c.Client = srv.Client()
+
+	if err := sendReport(c, []byte("{}")); err != nil {
+		t.Errorf("status %d: %v", status, err)
+	}
+	for _, status = range []int{http.StatusForbidden, http.StatusInternalServerError} {
+		if err := sendReport(c, []byte("{}")); err == nil {
+			t.Errorf("status %d: no error", status)
+		}
+	}
+}
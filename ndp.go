@@ -1,32 +1,51 @@
 package main
 
 import (
-	"fmt"
+	"log/slog"
 	"net"
 	"net/netip"
 	"time"
 
 	"github.com/hashicorp/go-multierror"
+	"github.com/lemmi/closer"
 	"golang.org/x/net/icmp"
 	"golang.org/x/net/ipv6"
 )
 
 type ndp struct {
-	c net.PacketConn
-	p *ipv6.PacketConn
+	c   net.PacketConn
+	p   *ipv6.PacketConn
+	log *slog.Logger
 }
 
-func newNDP() (ndp, error) {
+func newNDP(log *slog.Logger) (n ndp, err error) {
 	c, err := net.ListenPacket("ip6:58", "::")
 	if err != nil {
 		return ndp{}, err
 	}
+	defer func() {
+		if err != nil {
+			closer.Do(c)
+		}
+	}()
+
 	p := ipv6.NewPacketConn(c)
 	if err := p.SetMulticastHopLimit(255); err != nil {
 		return ndp{}, err
 	}
 
-	return ndp{c: c, p: p}, nil
+	// only neighbor advertisements are of interest
+	var filter ipv6.ICMPFilter
+	filter.SetAll(true)
+	filter.Accept(ipv6.ICMPTypeNeighborAdvertisement)
+	if err := p.SetICMPFilter(&filter); err != nil {
+		return ndp{}, err
+	}
+	if err := p.SetControlMessage(ipv6.FlagInterface|ipv6.FlagHopLimit, true); err != nil {
+		return ndp{}, err
+	}
+
+	return ndp{c: c, p: p, log: log}, nil
 }
 
 func (n ndp) Close() error {
@@ -82,53 +101,141 @@ func ndpMessage(from net.Interface, to netip.Addr) (ipv6.Message, error) {
 	}, nil
 }
 
-func (n ndp) solicit(timeout time.Duration, iface net.Interface, targets ...netip.Addr) ([]ipv6.Message, error) {
-	var ms []ipv6.Message
+// neighborAdvertisement is a parsed reply to a neighbor solicitation
+type neighborAdvertisement struct {
+	target    netip.Addr
+	mac       net.HardwareAddr
+	router    bool
+	solicited bool
+	override  bool
+	rtt       time.Duration
+}
 
-	if len(targets) == 0 {
-		return nil, nil
+// NDP constants from RFC 4861
+const (
+	ndpFlagRouter    = 0x80
+	ndpFlagSolicited = 0x40
+	ndpFlagOverride  = 0x20
+
+	ndpOptionTargetLinkLayerAddr = 2
+)
+
+// parseNeighborAdvertisement parses an ICMPv6 message. ok is false if it isn't
+// a valid neighbor advertisement.
+func parseNeighborAdvertisement(b []byte) (na neighborAdvertisement, ok bool) {
+	m, err := icmp.ParseMessage(ipv6.ICMPTypeNeighborAdvertisement.Protocol(), b)
+	if err != nil || m.Type != ipv6.ICMPTypeNeighborAdvertisement || m.Code != 0 {
+		return na, false
+	}
+	body, ok := m.Body.(*icmp.RawBody)
+	if !ok || len(body.Data) < 20 {
+		return na, false
+	}
+	data := body.Data
+
+	na.router = data[0]&ndpFlagRouter != 0
+	na.solicited = data[0]&ndpFlagSolicited != 0
+	na.override = data[0]&ndpFlagOverride != 0
+	na.target, _ = netip.AddrFromSlice(data[4:20])
+
+	// options are multiples of 8 bytes including type and length
+	for opts := data[20:]; len(opts) >= 8; {
+		length := int(opts[1]) * 8
+		if length == 0 || length > len(opts) {
+			return na, false
+		}
+		if opts[0] == ndpOptionTargetLinkLayerAddr {
+			na.mac = net.HardwareAddr(append([]byte(nil), opts[2:length]...))
+			// strip padding for 6 byte addresses
+			if length == 8 {
+				na.mac = na.mac[:6]
+			}
+		}
+		opts = opts[length:]
 	}
 
+	return na, true
+}
+
+// solicit sends neighbor solicitations for all targets on iface and collects
+// the matching advertisements until all targets answered or the timeout
+// expired.
+// onLink reports whether a packet was received on the interface and sent from
+// the link itself. Routers decrement the hop limit of 255, so off-link senders
+// can't forge it (RFC 4861, section 7.1.2).
+func onLink(cm *ipv6.ControlMessage, ifindex int) bool {
+	return cm != nil && cm.IfIndex == ifindex && cm.HopLimit == 255
+}
+
+func (n ndp) solicit(timeout time.Duration, iface net.Interface, targets ...netip.Addr) ([]neighborAdvertisement, error) {
+	var ms []ipv6.Message
+	pending := map[netip.Addr]struct{}{}
+
 	for _, target := range targets {
 		if target.Is4() {
 			// skip v4 addresses
 			continue
 		}
+		target = target.WithZone("")
+		if _, ok := pending[target]; ok {
+			continue
+		}
 		m, err := ndpMessage(iface, target)
 		if err != nil {
 			return nil, err
 		}
 
-		fmt.Printf("Sending Neighbor Solicitation request to %s\n", m.Addr)
+		n.log.Debug("Sending neighbor solicitation", "iface", iface.Name, "target", clientHash.addr(target))
 		ms = append(ms, m)
+		pending[target] = struct{}{}
 	}
 
-	if _, err := n.p.WriteBatch(ms, 0); err != nil {
-		return nil, err
+	if len(ms) == 0 {
+		return nil, nil
 	}
 
-	if err := n.p.SetReadDeadline(time.Now().Add(timeout)); err != nil {
-		return nil, err
+	sent := time.Now()
+	for len(ms) > 0 {
+		c, err := n.p.WriteBatch(ms, 0)
+		if err != nil {
+			return nil, err
+		}
+		ms = ms[c:]
 	}
 
-	rms := make([]ipv6.Message, len(targets))
-	for i := range rms {
-		rms[i].Buffers = [][]byte{make([]byte, iface.MTU)}
+	if err := n.p.SetReadDeadline(sent.Add(timeout)); err != nil {
+		return nil, err
 	}
 
-	var nr int
-loop:
-	for nr < len(rms) {
-		c, err := n.p.ReadBatch(rms[nr:], 0)
+	var nas []neighborAdvertisement
+	buf := make([]byte, 1500)
+	if iface.MTU > len(buf) {
+		buf = make([]byte, iface.MTU)
+	}
+	for len(pending) > 0 {
+		c, cm, _, err := n.p.ReadFrom(buf)
 		if err != nil {
 			if e, ok := err.(*net.OpError); ok && e.Timeout() {
-				break loop
+				break
 			}
 			return nil, err
 		}
-		nr += c
-		fmt.Println(c)
+		if !onLink(cm, iface.Index) {
+			continue
+		}
+
+		na, ok := parseNeighborAdvertisement(buf[:c])
+		if !ok {
+			continue
+		}
+		if _, ok := pending[na.target]; !ok {
+			continue
+		}
+		delete(pending, na.target)
+
+		na.rtt = time.Since(sent)
+		nas = append(nas, na)
 	}
 
-	return rms[:nr], nil
+	return nas, nil
 }
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+)
+
+func neighborAdvertisementPacket(t *testing.T, flags byte, target netip.Addr, opts ...byte) []byte {
+	t.Helper()
+	data := make([]byte, 4, 20+len(opts))
+	data[0] = flags
+	data = append(data, target.AsSlice()...)
+	data = append(data, opts...)
+	b, err := (&icmp.Message{
+		Type: ipv6.ICMPTypeNeighborAdvertisement,
+		Body: &icmp.RawBody{Data: data},
+	}).Marshal(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestParseNeighborAdvertisement(t *testing.T) {
+	target := netip.MustParseAddr("fe80::1")
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	tlla := append([]byte{ndpOptionTargetLinkLayerAddr, 1}, mac...)
+
+	na, ok := parseNeighborAdvertisement(neighborAdvertisementPacket(t,
+		ndpFlagSolicited|ndpFlagOverride, target,
+		// an unknown option before the target link-layer address
+		append([]byte{14, 1, 0, 0, 0, 0, 0, 0}, tlla...)...))
+	if !ok {
+		t.Fatal("advertisement not parsed")
+	}
+	if na.target != target || na.mac.String() != mac.String() {
+		t.Errorf("target %s mac %s, want %s %s", na.target, na.mac, target, mac)
+	}
+	if na.router || !na.solicited || !na.override {
+		t.Errorf("flags router %v solicited %v override %v", na.router, na.solicited, na.override)
+	}
+
+	na, ok = parseNeighborAdvertisement(neighborAdvertisementPacket(t, ndpFlagRouter, target))
+	if !ok || !na.router || na.mac != nil {
+		t.Errorf("advertisement without options = %+v, %v", na, ok)
+	}
+}
+
+func TestParseNeighborAdvertisementInvalid(t *testing.T) {
+	target := netip.MustParseAddr("fe80::1")
+
+	solicitation, err := ndpPayload(net.HardwareAddr{0x02, 0, 0, 0, 0, 1}, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string][]byte{
+		"empty":           nil,
+		"solicitation":    solicitation,
+		"short":           neighborAdvertisementPacket(t, 0, target)[:20],
+		"zero length":     neighborAdvertisementPacket(t, 0, target, ndpOptionTargetLinkLayerAddr, 0, 0, 0, 0, 0, 0, 0),
+		"option too long": neighborAdvertisementPacket(t, 0, target, ndpOptionTargetLinkLayerAddr, 2, 0, 0, 0, 0, 0, 0),
+	}
+	for name, b := range tests {
+		if na, ok := parseNeighborAdvertisement(b); ok {
+			t.Errorf("%s: parsed %+v", name, na)
+		}
+	}
+}
+
+func TestOnLink(t *testing.T) {
+	tests := []struct {
+		name string
+		cm   *ipv6.ControlMessage
+		want bool
+	}{
+		{"on link", &ipv6.ControlMessage{IfIndex: 2, HopLimit: 255}, true},
+		{"routed", &ipv6.ControlMessage{IfIndex: 2, HopLimit: 254}, false},
+		{"other interface", &ipv6.ControlMessage{IfIndex: 3, HopLimit: 255}, false},
+		{"no control message", nil, false},
+	}
+	for _, tt := range tests {
+		if got := onLink(tt.cm, 2); got != tt.want {
+			t.Errorf("%s: onLink() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
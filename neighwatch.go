@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// clientTable collects the clients that were reachable on each link since the
+// previous crawl. It is fed by netlink notifications in the background, so
+// clients that left before the crawl are still counted.
+type clientTable struct {
+	mu    sync.Mutex
+	links map[int]map[string]net.HardwareAddr
+}
+
+func newClientTable() *clientTable {
+	return &clientTable{
+		links: map[int]map[string]net.HardwareAddr{},
+	}
+}
+
+// update records the neighbour of u if it is reachable. Bridge entries are
+// ignored, the fdb count method reads the whole forwarding database, which
+// already keeps stations for the ageing time.
+func (t *clientTable) update(u netlink.NeighUpdate) {
+	if u.Type != unix.RTM_NEWNEIGH || u.Family == unix.AF_BRIDGE {
+		return
+	}
+	if u.State&netlink.NUD_REACHABLE == 0 || len(u.HardwareAddr) == 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	clients, ok := t.links[u.LinkIndex]
+	if !ok {
+		clients = map[string]net.HardwareAddr{}
+		t.links[u.LinkIndex] = clients
+	}
+	clients[u.HardwareAddr.String()] = u.HardwareAddr
+}
+
+// forget drops the clients of a deleted link, as its index may be reused
+func (t *clientTable) forget(index int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.links, index)
+}
+
+// drain returns the clients seen on each link and starts a new interval
+func (t *clientTable) drain() map[int][]net.HardwareAddr {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	drained := make(map[int][]net.HardwareAddr, len(t.links))
+	for index, clients := range t.links {
+		macs := make([]net.HardwareAddr, 0, len(clients))
+		for _, mac := range clients {
+			macs = append(macs, mac)
+		}
+		drained[index] = macs
+	}
+	t.links = map[int]map[string]net.HardwareAddr{}
+	return drained
+}
+
+// watch subscribes to neighbour and link notifications and keeps t up to date.
+// Subscriptions are renewed after errors, e.g. when the socket overran.
+func (t *clientTable) watch(c Config) {
+	const retry = 10 * time.Second
+	for {
+		if err := t.subscribe(); err != nil {
+			c.Log.Warn("Neighbour subscription failed", "err", err)
+		}
+		time.Sleep(retry)
+	}
+}
+
+// subscribe processes notifications until one of the subscriptions ends
+func (t *clientTable) subscribe() error {
+	// closing stop closes the netlink sockets, but doesn't wake up the
+	// receiving goroutines. They only end and close their channel with the
+	// next notification and must not block on a full channel until then, so
+	// the channels are drained in the background.
+	stop := make(chan struct{})
+
+	var neighErr, linkErr error
+	neighs := make(chan netlink.NeighUpdate, 64)
+	if err := netlink.NeighSubscribeWithOptions(neighs, stop, netlink.NeighSubscribeOptions{
+		ErrorCallback: func(err error) { neighErr = err },
+	}); err != nil {
+		close(stop)
+		return err
+	}
+
+	links := make(chan netlink.LinkUpdate, 16)
+	if err := netlink.LinkSubscribeWithOptions(links, stop, netlink.LinkSubscribeOptions{
+		ErrorCallback: func(err error) { linkErr = err },
+	}); err != nil {
+		close(stop)
+		go func() {
+			for range neighs {
+			}
+		}()
+		return err
+	}
+
+	defer func() {
+		close(stop)
+		go func() {
+			for range neighs {
+			}
+		}()
+		go func() {
+			for range links {
+			}
+		}()
+	}()
+
+	for {
+		select {
+		case u, ok := <-neighs:
+			if !ok {
+				return neighErr
+			}
+			t.update(u)
+		case u, ok := <-links:
+			if !ok {
+				return linkErr
+			}
+			if u.Header.Type == unix.RTM_DELLINK && u.Family != unix.AF_BRIDGE {
+				t.forget(int(u.Index))
+			}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net"
+	"sort"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+func neighUpdate(typ uint16, family, index, state int, mac net.HardwareAddr) netlink.NeighUpdate {
+	return netlink.NeighUpdate{
+		Type: typ,
+		Neigh: netlink.Neigh{
+			LinkIndex:    index,
+			Family:       family,
+			State:        state,
+			HardwareAddr: mac,
+		},
+	}
+}
+
+func sortedMACs(macs []net.HardwareAddr) []string {
+	var ret []string
+	for _, mac := range macs {
+		ret = append(ret, mac.String())
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func TestClientTable(t *testing.T) {
+	table := newClientTable()
+
+	for _, u := range []netlink.NeighUpdate{
+		neighUpdate(unix.RTM_NEWNEIGH, unix.AF_INET6, 2, netlink.NUD_REACHABLE, testMAC(1)),
+		neighUpdate(unix.RTM_NEWNEIGH, unix.AF_INET, 2, netlink.NUD_REACHABLE, testMAC(2)),
+		// the same client seen again
+		neighUpdate(unix.RTM_NEWNEIGH, unix.AF_INET, 2, netlink.NUD_REACHABLE, testMAC(1)),
+		neighUpdate(unix.RTM_NEWNEIGH, unix.AF_INET6, 3, netlink.NUD_REACHABLE, testMAC(3)),
+		// ignored
+		neighUpdate(unix.RTM_NEWNEIGH, unix.AF_INET6, 2, netlink.NUD_STALE, testMAC(4)),
+		neighUpdate(unix.RTM_NEWNEIGH, unix.AF_INET6, 2, netlink.NUD_FAILED, testMAC(5)),
+		neighUpdate(unix.RTM_DELNEIGH, unix.AF_INET6, 2, netlink.NUD_REACHABLE, testMAC(6)),
+		neighUpdate(unix.RTM_NEWNEIGH, unix.AF_BRIDGE, 2, netlink.NUD_REACHABLE, testMAC(7)),
+		neighUpdate(unix.RTM_NEWNEIGH, unix.AF_INET6, 2, netlink.NUD_REACHABLE, nil),
+	} {
+		table.update(u)
+	}
+	table.update(neighUpdate(unix.RTM_NEWNEIGH, unix.AF_INET6, 4, netlink.NUD_REACHABLE, testMAC(8)))
+	// link 4 was deleted
+	table.forget(4)
+
+	drained := table.drain()
+	if len(drained) != 2 {
+		t.Errorf("drained %d links, want 2", len(drained))
+	}
+	if got := sortedMACs(drained[2]); len(got) != 2 || got[0] != testMAC(1).String() || got[1] != testMAC(2).String() {
+		t.Errorf("link 2 clients %v", got)
+	}
+	if got := sortedMACs(drained[3]); len(got) != 1 || got[0] != testMAC(3).String() {
+		t.Errorf("link 3 clients %v", got)
+	}
+
+	// drain starts a new interval
+	if drained := table.drain(); len(drained) != 0 {
+		t.Errorf("drained %v again", drained)
+	}
+}
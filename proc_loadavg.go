@@ -16,9 +16,9 @@ type loadavg struct {
 	recent   int
 }
 
-func readLoadavg() (loadavg, error) {
+func readLoadavg(fs hostFS) (loadavg, error) {
 	var load loadavg
-	fLoad, err := os.Open("/proc/loadavg")
+	fLoad, err := os.Open(fs.procPath("loadavg"))
 	if err != nil {
 		return load, err
 	}
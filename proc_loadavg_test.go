@@ -0,0 +1,16 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestReadLoadavg(t *testing.T) {
+	load, err := readLoadavg(fixtureFS(t, "openwrt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := loadavg{load1: 0.12, load5: 0.34, load15: 0.56, runnable: 2, procs: 87, recent: 4321}
+	if load != want {
+		t.Errorf("readLoadavg() = %+v, want %+v", load, want)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lemmi/closer"
+)
+
+// readRelease parses shell style KEY=value files like /etc/os-release
+func readRelease(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Do(f)
+
+	values := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		value := kv[1]
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[kv[0]] = value
+	}
+
+	return values, scanner.Err()
+}
+
+// configFromRelease derives the distribution and firmware options from
+// os-release and, where present, openwrt_release
+func configFromRelease(etc string) (configSource, error) {
+	s := newConfigSource("os-release")
+
+	set := func(name, value string) {
+		if value != "" {
+			// only string fields are set here
+			_ = s.parse(name, value)
+		}
+	}
+
+	osRelease, err := readRelease(filepath.Join(etc, "os-release"))
+	if os.IsNotExist(err) {
+		// fallback location according to os-release(5)
+		osRelease, err = readRelease(filepath.Join(etc, "../usr/lib/os-release"))
+	}
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return s, err
+	default:
+		set("Distname", osRelease["NAME"])
+		set("Distversion", firstOf(osRelease["VERSION_ID"], osRelease["VERSION"]))
+		set("FirmwareVersion", firstOf(osRelease["VERSION"], osRelease["VERSION_ID"]))
+		set("FirmwareRevision", osRelease["BUILD_ID"])
+	}
+
+	openwrtRelease, err := readRelease(filepath.Join(etc, "openwrt_release"))
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return s, err
+	default:
+		set("Distname", openwrtRelease["DISTRIB_ID"])
+		set("Distversion", openwrtRelease["DISTRIB_RELEASE"])
+		set("FirmwareVersion", openwrtRelease["DISTRIB_RELEASE"])
+		set("FirmwareRevision", openwrtRelease["DISTRIB_REVISION"])
+		set("OpenwrtCoreRevision", openwrtRelease["DISTRIB_REVISION"])
+	}
+
+	return s, nil
+}
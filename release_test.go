@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestConfigFromRelease(t *testing.T) {
+	s, err := configFromRelease("testdata/openwrt/etc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"Distname":            "OpenWrt",
+		"Distversion":         "23.05.3",
+		"FirmwareVersion":     "23.05.3",
+		"FirmwareRevision":    "r23809-234f1a2efa",
+		"OpenwrtCoreRevision": "r23809-234f1a2efa",
+	}
+	for name, value := range want {
+		field, _, _ := configField(&s.config, name)
+		if !s.set[name] || field.String() != value {
+			t.Errorf("%s = %q (set %v), want %q", name, field.String(), s.set[name], value)
+		}
+	}
+}
+
+func TestConfigFromReleaseMissing(t *testing.T) {
+	s, err := configFromRelease("testdata/missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.set) != 0 {
+		t.Errorf("set %v without release files", s.set)
+	}
+}
+
+func TestConfigMergeGatewayJSONRelease(t *testing.T) {
+	fromFile, err := configFromFile("gateway.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromRelease, err := configFromRelease("testdata/openwrt/etc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, origins := configMerge(fromFile, fromRelease)
+	if c.Distname != "OpenWrt" || origins["Distname"] != "os-release" {
+		t.Errorf("Distname = %q from %q, want %q from os-release", c.Distname, origins["Distname"], "OpenWrt")
+	}
+	if c.Distversion != "23.05.3" || origins["Distversion"] != "os-release" {
+		t.Errorf("Distversion = %q from %q, want %q from os-release", c.Distversion, origins["Distversion"], "23.05.3")
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/lemmi/closer"
+	alfredxml "github.com/lemmi/gnw/alfredxml"
+)
+
+// clientKey keys the client identifiers. It only lives in memory, so
+// identifiers can't be linked to hardware addresses or across restarts.
+// Identifiers are stable for the lifetime of the process to track sessions
+// and must be passed through clientHash before they are written anywhere.
+var clientKey = func() []byte {
+	key := make([]byte, sha256.Size)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+// clientID returns an opaque identifier for the client with hardware address
+// mac
+func clientID(mac net.HardwareAddr) string {
+	m := hmac.New(sha256.New, clientKey)
+	m.Write(mac)
+	return hex.EncodeToString(m.Sum(nil)[:8])
+}
+
+// client event types
+const (
+	clientConnect    = "connect"
+	clientDisconnect = "disconnect"
+)
+
+// clientEvent is a client appearing on or leaving an interface
+type clientEvent struct {
+	Event     string `json:"event"`
+	Interface string `json:"interface"`
+	Client    string `json:"client"`
+	Time      int64  `json:"time"`
+	// session duration in seconds, only set on disconnect
+	Duration float64 `json:"duration,omitempty"`
+}
+
+// ifaceSessions holds the connection time of every client of an interface
+type ifaceSessions struct {
+	time    time.Time
+	clients map[string]time.Time
+}
+
+// clientSessions updates the sessions of ifname with the clients seen at now
+// and reports the changes since the previous crawl. The first crawl of an
+// interface only records the present clients, as it can't tell when they
+// connected.
+func (h *history) clientSessions(ifname string, macs []net.HardwareAddr, now time.Time) (alfredxml.ClientSessions, []clientEvent) {
+	s := alfredxml.ClientSessions{
+		XMLName: xml.Name{
+			Local: ifname,
+		},
+	}
+	if h.sessions == nil {
+		h.sessions = map[string]ifaceSessions{}
+	}
+	prev, known := h.sessions[ifname]
+	cur := ifaceSessions{
+		time:    now,
+		clients: make(map[string]time.Time, len(macs)),
+	}
+
+	var events []clientEvent
+	for _, mac := range macs {
+		id := clientID(mac)
+		if start, ok := prev.clients[id]; ok {
+			cur.clients[id] = start
+			continue
+		}
+		cur.clients[id] = now
+		if !known {
+			continue
+		}
+		s.New++
+		events = append(events, clientEvent{
+			Event:     clientConnect,
+			Interface: ifname,
+			Client:    clientHash.id(id),
+			Time:      now.Unix(),
+		})
+	}
+
+	var departed float64
+	for id, start := range prev.clients {
+		if _, ok := cur.clients[id]; ok {
+			continue
+		}
+		d := now.Sub(start).Seconds()
+		departed += d
+		s.Departed++
+		events = append(events, clientEvent{
+			Event:     clientDisconnect,
+			Interface: ifname,
+			Client:    clientHash.id(id),
+			Time:      now.Unix(),
+			Duration:  d,
+		})
+	}
+	if s.Departed > 0 {
+		s.DepartedDurationAvg = departed / float64(s.Departed)
+	}
+
+	var active float64
+	for _, start := range cur.clients {
+		d := now.Sub(start).Seconds()
+		active += d
+		if d > s.DurationMax {
+			s.DurationMax = d
+		}
+	}
+	if len(cur.clients) > 0 {
+		s.DurationAvg = active / float64(len(cur.clients))
+	}
+
+	h.sessions[ifname] = cur
+	return s, events
+}
+
+// pruneSessions forgets the sessions of all interfaces that were not updated
+// at now
+func (h *history) pruneSessions(now time.Time) {
+	for name, s := range h.sessions {
+		if !s.time.Equal(now) {
+			delete(h.sessions, name)
+		}
+	}
+}
+
+// emitClientEvents writes events to the log or posts them as a json array to
+// the ClientEvents URL
+func emitClientEvents(c Config, events []clientEvent) error {
+	if len(events) == 0 || c.ClientEvents == "" {
+		return nil
+	}
+
+	if c.ClientEvents == "log" {
+		for _, e := range events {
+			args := []any{"event", e.Event, "iface", e.Interface, "client", e.Client}
+			if e.Event == clientDisconnect {
+				args = append(args, "duration", e.Duration)
+			}
+			c.Log.Info("Client event", args...)
+		}
+		return nil
+	}
+
+	body, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+
+	c.Log.Debug("Client events", "events", string(body))
+	if c.Dry {
+		return nil
+	}
+
+	req, err := http.NewRequest("POST", c.ClientEvents, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Close = true
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer closer.Do(resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("client events: %s", resp.Status)
+	}
+	return nil
+}
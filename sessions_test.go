@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	alfredxml "github.com/lemmi/gnw/alfredxml"
+)
+
+func TestClientSessions(t *testing.T) {
+	var h history
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	a, b, c := testMAC(1), testMAC(2), testMAC(3)
+
+	// the first crawl only records the present clients
+	s, events := h.clientSessions("br-client", []net.HardwareAddr{a, b}, start)
+	if s.New != 0 || s.Departed != 0 || len(events) != 0 {
+		t.Errorf("first crawl = %+v, %v", s, events)
+	}
+
+	now := start.Add(5 * time.Minute)
+	s, events = h.clientSessions("br-client", []net.HardwareAddr{a, c}, now)
+	want := alfredxml.ClientSessions{
+		New:                 1,
+		Departed:            1,
+		DurationAvg:         150,
+		DurationMax:         300,
+		DepartedDurationAvg: 300,
+	}
+	s.XMLName.Local = ""
+	if s != want {
+		t.Errorf("sessions = %+v, want %+v", s, want)
+	}
+
+	kinds := map[string]clientEvent{}
+	for _, e := range events {
+		kinds[e.Event] = e
+	}
+	if len(events) != 2 || kinds[clientConnect].Client != clientHash.mac(c) || kinds[clientDisconnect].Client != clientHash.mac(b) {
+		t.Errorf("events = %+v", events)
+	}
+	if d := kinds[clientDisconnect].Duration; d != 300 {
+		t.Errorf("disconnect duration = %v, want 300", d)
+	}
+	for _, e := range events {
+		if e.Interface != "br-client" || e.Time != now.Unix() {
+			t.Errorf("event %+v", e)
+		}
+	}
+
+	// interfaces missing from a crawl are forgotten
+	h.pruneSessions(now.Add(time.Minute))
+	if len(h.sessions) != 0 {
+		t.Errorf("%d interfaces left after pruning", len(h.sessions))
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	alfredxml "github.com/lemmi/gnw/alfredxml"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+// link types that are always considered tunnels
+var tunnelTypes = map[string]bool{
+	"wireguard": true,
+	"gre":       true,
+	"gretap":    true,
+	"ip6gre":    true,
+	"ip6gretap": true,
+	"ipip":      true,
+	"ip6tnl":    true,
+	"sit":       true,
+	"vti":       true,
+	"vti6":      true,
+	"l2tp":      true,
+	"xfrm":      true,
+}
+
+// WireGuard peers without a handshake within this duration are inactive
+const wireguardHandshakeTimeout = 3 * time.Minute
+
+// generic netlink constants from linux/wireguard.h
+const (
+	wgCmdGetDevice = 0
+	wgGenlVersion  = 1
+
+	wgDeviceAIfname = 2
+	wgDeviceAPeers  = 8
+
+	wgPeerAPublicKey         = 1
+	wgPeerAEndpoint          = 4
+	wgPeerALastHandshakeTime = 6
+	wgPeerARxBytes           = 7
+	wgPeerATxBytes           = 8
+)
+
+// isTunnel reports if link is a tunnel by its type or one of the configured
+// VpnIfNames patterns, as tun/tap devices can't be told apart otherwise
+func isTunnel(c Config, link netlink.Link) bool {
+	if tunnelTypes[link.Type()] {
+		return true
+	}
+	for _, pattern := range strings.Split(c.VpnIfNames, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if ok, _ := filepath.Match(pattern, link.Attrs().Name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSockaddr formats a struct sockaddr_in or sockaddr_in6. The family is in
+// host byte order, the port in network byte order.
+func parseSockaddr(b []byte) string {
+	if len(b) < 4 {
+		return ""
+	}
+	port := binary.BigEndian.Uint16(b[2:4])
+	switch nl.NativeEndian().Uint16(b[0:2]) {
+	case unix.AF_INET:
+		if len(b) < 8 {
+			return ""
+		}
+		return net.JoinHostPort(net.IP(b[4:8]).String(), strconv.Itoa(int(port)))
+	case unix.AF_INET6:
+		if len(b) < 24 {
+			return ""
+		}
+		return net.JoinHostPort(net.IP(b[8:24]).String(), strconv.Itoa(int(port)))
+	}
+	return ""
+}
+
+func parseWireguardPeer(b []byte, now time.Time) (alfredxml.TunnelPeer, error) {
+	var peer alfredxml.TunnelPeer
+
+	attrs, err := nl.ParseRouteAttr(b)
+	if err != nil {
+		return peer, err
+	}
+	for _, attr := range attrs {
+		switch attr.Attr.Type &^ unix.NLA_F_NESTED {
+		case wgPeerAPublicKey:
+			peer.PublicKey = base64.StdEncoding.EncodeToString(attr.Value)
+		case wgPeerAEndpoint:
+			peer.Endpoint = parseSockaddr(attr.Value)
+		case wgPeerALastHandshakeTime:
+			if len(attr.Value) < 16 {
+				continue
+			}
+			sec := int64(nl.NativeEndian().Uint64(attr.Value[0:8]))
+			nsec := int64(nl.NativeEndian().Uint64(attr.Value[8:16]))
+			if sec == 0 && nsec == 0 {
+				continue
+			}
+			peer.LastHandshake = sec
+			if now.Sub(time.Unix(sec, nsec)) < wireguardHandshakeTimeout {
+				peer.Active = 1
+			}
+		case wgPeerARxBytes:
+			if len(attr.Value) >= 8 {
+				peer.TrafficRx = nl.NativeEndian().Uint64(attr.Value)
+			}
+		case wgPeerATxBytes:
+			if len(attr.Value) >= 8 {
+				peer.TrafficTx = nl.NativeEndian().Uint64(attr.Value)
+			}
+		}
+	}
+
+	return peer, nil
+}
+
+// wireguardPeers queries the peers of a WireGuard interface via generic
+// netlink. Large peer lists are split over several messages.
+func wireguardPeers(ifname string) ([]alfredxml.TunnelPeer, error) {
+	family, err := netlink.GenlFamilyGet("wireguard")
+	if err != nil {
+		return nil, err
+	}
+
+	req := nl.NewNetlinkRequest(int(family.ID), unix.NLM_F_DUMP)
+	req.AddData(&nl.Genlmsg{
+		Command: wgCmdGetDevice,
+		Version: wgGenlVersion,
+	})
+	req.AddData(nl.NewRtAttr(wgDeviceAIfname, nl.ZeroTerminated(ifname)))
+	msgs, err := req.Execute(unix.NETLINK_GENERIC, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var peers []alfredxml.TunnelPeer
+	for _, m := range msgs {
+		attrs, err := nl.ParseRouteAttr(m[nl.SizeofGenlmsg:])
+		if err != nil {
+			return nil, err
+		}
+		for _, attr := range attrs {
+			if attr.Attr.Type&^unix.NLA_F_NESTED != wgDeviceAPeers {
+				continue
+			}
+			list, err := nl.ParseRouteAttr(attr.Value)
+			if err != nil {
+				return nil, err
+			}
+			for _, p := range list {
+				peer, err := parseWireguardPeer(p.Value, now)
+				if err != nil {
+					return nil, err
+				}
+				peers = append(peers, peer)
+			}
+		}
+	}
+
+	return peers, nil
+}
+
+// readTunnels reports all tunnel interfaces. A tunnel is active if it is up
+// and, for WireGuard, has at least one peer with a recent handshake.
+func readTunnels(c Config, links []netlink.Link) ([]alfredxml.Tunnel, error) {
+	var tunnels []alfredxml.Tunnel
+
+	for _, link := range links {
+		if !isTunnel(c, link) {
+			continue
+		}
+		attrs := link.Attrs()
+
+		t := alfredxml.Tunnel{
+			Name: attrs.Name,
+			Type: link.Type(),
+		}
+		up := attrs.Flags&net.FlagUp != 0 &&
+			attrs.OperState != netlink.OperDown &&
+			attrs.OperState != netlink.OperLowerLayerDown
+
+		if link.Type() == "wireguard" {
+			peers, err := wireguardPeers(attrs.Name)
+			if err != nil {
+				return tunnels, err
+			}
+			t.Peers = peers
+
+			var active bool
+			for _, p := range peers {
+				active = active || p.Active == 1
+			}
+			up = up && active
+		}
+
+		if up {
+			t.Active = 1
+		}
+		tunnels = append(tunnels, t)
+	}
+
+	return tunnels, nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestParseSockaddr(t *testing.T) {
+	sa4 := unix.RawSockaddrInet4{
+		Family: unix.AF_INET,
+		Port:   htons(51820),
+		Addr:   [4]byte{192, 0, 2, 1},
+	}
+	sa6 := unix.RawSockaddrInet6{
+		Family: unix.AF_INET6,
+		Port:   htons(51820),
+		Addr:   [16]byte{0x20, 0x01, 0x0d, 0xb8, 15: 1},
+	}
+
+	tests := []struct {
+		name string
+		b    []byte
+		want string
+	}{
+		{"inet", (*[unix.SizeofSockaddrInet4]byte)(unsafe.Pointer(&sa4))[:], "192.0.2.1:51820"},
+		{"inet6", (*[unix.SizeofSockaddrInet6]byte)(unsafe.Pointer(&sa6))[:], "[2001:db8::1]:51820"},
+		{"short", []byte{2, 0}, ""},
+		{"truncated inet6", (*[unix.SizeofSockaddrInet6]byte)(unsafe.Pointer(&sa6))[:12], ""},
+	}
+	for _, tt := range tests {
+		if got := parseSockaddr(tt.b); got != tt.want {
+			t.Errorf("%s: parseSockaddr() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}